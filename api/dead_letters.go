@@ -0,0 +1,161 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	queue "github.com/luqmanMohammed/k8s-events-runner/queue"
+	"k8s.io/klog/v2"
+)
+
+const deadLettersPath = "/api/v1/deadletters"
+
+//deadLetterResponse summarises a dead-lettered job
+type deadLetterResponse struct {
+	jobResponse
+	EnqueuedAt     time.Time `json:"enqueuedAt"`
+	DeadLetteredAt time.Time `json:"deadLetteredAt"`
+	Attempts       int       `json:"attempts"`
+	LastError      string    `json:"lastError"`
+}
+
+//newJobResponse describes the job
+func newJobResponse(job *queue.Job) jobResponse {
+	return jobResponse{
+		ID:        job.ID,
+		Runner:    job.Runner,
+		Resource:  job.Resource,
+		EventType: job.EventType,
+	}
+}
+
+//deadLettersHandler serves the dead-letter store:
+//GET /api/v1/deadletters lists all dead-lettered jobs,
+//GET /api/v1/deadletters/{id} returns the full dead-lettered job,
+//DELETE /api/v1/deadletters/{id} discards the job and
+//POST /api/v1/deadletters/{id}/replay queues the job again
+func (ers *erServer) deadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, deadLettersPath), "/")
+	if path == "" {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		ers.listDeadLetters(w)
+		return
+	}
+	parts := strings.Split(path, "/")
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		ers.getDeadLetter(w, parts[0])
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		ers.deleteDeadLetter(w, parts[0])
+	case len(parts) == 2 && parts[1] == "replay" && r.Method == http.MethodPost:
+		ers.replayDeadLetter(w, r, parts[0])
+	case len(parts) <= 2:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+//writeDeadLetterError writes the response for a failed dead-letter store operation
+func writeDeadLetterError(w http.ResponseWriter, id string, err error) {
+	if errors.Is(err, queue.ErrJobNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(baseResponse{Message: fmt.Sprintf("Dead-lettered job %s not found", id)})
+		return
+	}
+	klog.Errorf("Dead-letter store operation for job %s failed: %v", id, err)
+	w.WriteHeader(http.StatusInternalServerError)
+	json.NewEncoder(w).Encode(baseResponse{Message: fmt.Sprintf("Dead-letter store operation failed: %v", err)})
+}
+
+func (ers *erServer) listDeadLetters(w http.ResponseWriter) {
+	jobs, err := ers.deadLetters.List()
+	if err != nil {
+		writeDeadLetterError(w, "", err)
+		return
+	}
+	response := make([]deadLetterResponse, 0, len(jobs))
+	for _, job := range jobs {
+		response = append(response, deadLetterResponse{
+			jobResponse:    newJobResponse(job),
+			EnqueuedAt:     job.EnqueuedAt,
+			DeadLetteredAt: job.DeadLetteredAt,
+			Attempts:       job.Attempts,
+			LastError:      job.LastError,
+		})
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (ers *erServer) getDeadLetter(w http.ResponseWriter, id string) {
+	job, err := ers.deadLetters.Get(id)
+	if err != nil {
+		writeDeadLetterError(w, id, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(job)
+}
+
+func (ers *erServer) deleteDeadLetter(w http.ResponseWriter, id string) {
+	if err := ers.deadLetters.Remove(id); err != nil {
+		writeDeadLetterError(w, id, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(baseResponse{Message: fmt.Sprintf("Discarded dead-lettered job %s", id)})
+}
+
+//replayDeadLetter queues the dead-lettered job again with its attempts reset and
+//removes it from the dead-letter store
+func (ers *erServer) replayDeadLetter(w http.ResponseWriter, r *http.Request, id string) {
+	job, err := ers.deadLetters.Get(id)
+	if err != nil {
+		writeDeadLetterError(w, id, err)
+		return
+	}
+	replayed := *job
+	replayed.EnqueuedAt = time.Time{}
+	replayed.DeadLetteredAt = time.Time{}
+	replayed.Attempts = 0
+	replayed.LastError = ""
+	ctx, cancel := context.WithTimeout(r.Context(), ers.enqueueTimeout)
+	defer cancel()
+	//the run of the job is recorded again from scratch, and restored if the job is not queued
+	previousRun, _ := ers.runStore.Get(id)
+	ers.deleteRuns([]*queue.Job{&replayed})
+	ers.createRuns([]*queue.Job{&replayed})
+	if err := ers.jobQueue.Enqueue(ctx, &replayed); err != nil {
+		ers.deleteRuns([]*queue.Job{&replayed})
+		if previousRun != nil {
+			ers.runStore.Create(previousRun)
+		}
+		if errors.Is(err, queue.ErrQueueFull) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(ers.retryAfter.Seconds())))
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(baseResponse{Message: "Job queue is full, retry later"})
+			return
+		}
+		klog.Errorf("Failed to replay dead-lettered job %s: %v", id, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(baseResponse{Message: fmt.Sprintf("Failed to enqueue job: %v", err)})
+		return
+	}
+	if err := ers.deadLetters.Remove(id); err != nil && !errors.Is(err, queue.ErrJobNotFound) {
+		klog.Errorf("Failed to remove replayed job %s from the dead-letter store: %v", id, err)
+	}
+	klog.V(1).Infof("Replayed dead-lettered job %s", id)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newJobResponse(&replayed))
+}
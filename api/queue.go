@@ -0,0 +1,155 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	queue "github.com/luqmanMohammed/k8s-events-runner/queue"
+	"k8s.io/klog/v2"
+)
+
+const queuePath = "/api/v1/queue"
+
+//queuedJobResponse describes a queued, delayed or dead-lettered job
+type queuedJobResponse struct {
+	jobResponse
+	Priority       int        `json:"priority"`
+	EnqueuedAt     time.Time  `json:"enqueuedAt"`
+	Attempts       int        `json:"attempts,omitempty"`
+	LastError      string     `json:"lastError,omitempty"`
+	ReleaseAt      *time.Time `json:"releaseAt,omitempty"`
+	DeadLetteredAt *time.Time `json:"deadLetteredAt,omitempty"`
+}
+
+//queueResponse lists all jobs waiting in the queue, the delay queue and the dead-letter store
+type queueResponse struct {
+	Paused       queue.PauseState    `json:"paused"`
+	Queued       []queuedJobResponse `json:"queued"`
+	Delayed      []queuedJobResponse `json:"delayed"`
+	DeadLettered []queuedJobResponse `json:"deadLettered"`
+}
+
+//newQueuedJobResponse describes the job
+func newQueuedJobResponse(job *queue.Job) queuedJobResponse {
+	return queuedJobResponse{
+		jobResponse: newJobResponse(job),
+		Priority:    job.Priority,
+		EnqueuedAt:  job.EnqueuedAt,
+		Attempts:    job.Attempts,
+		LastError:   job.LastError,
+	}
+}
+
+//queueHandler serves the job queue:
+//GET /api/v1/queue lists queued, delayed and dead-lettered jobs,
+//DELETE /api/v1/queue/jobs/{id} removes a queued or delayed job,
+//POST /api/v1/queue/pause and POST /api/v1/queue/resume pause and resume dequeuing
+//of all jobs, or of the jobs of a single runner with the runner query parameter
+func (ers *erServer) queueHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, queuePath), "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "":
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		ers.listQueue(w)
+	case len(parts) == 2 && parts[0] == "jobs":
+		if r.Method != http.MethodDelete {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		ers.deleteQueuedJob(w, r, parts[1])
+	case len(parts) == 1 && (parts[0] == "pause" || parts[0] == "resume"):
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		ers.pauseQueue(w, parts[0] == "pause", r.URL.Query().Get("runner"))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (ers *erServer) listQueue(w http.ResponseWriter) {
+	response := queueResponse{
+		Paused:       ers.jobQueue.Paused(),
+		Queued:       []queuedJobResponse{},
+		Delayed:      []queuedJobResponse{},
+		DeadLettered: []queuedJobResponse{},
+	}
+	for _, job := range ers.jobQueue.List() {
+		response.Queued = append(response.Queued, newQueuedJobResponse(job))
+	}
+	for _, delayed := range ers.delayQueue.List() {
+		releaseAt := delayed.ReleaseAt
+		jr := newQueuedJobResponse(delayed.Job)
+		jr.ReleaseAt = &releaseAt
+		response.Delayed = append(response.Delayed, jr)
+	}
+	deadLettered, err := ers.deadLetters.List()
+	if err != nil {
+		writeDeadLetterError(w, "", err)
+		return
+	}
+	for _, job := range deadLettered {
+		deadLetteredAt := job.DeadLetteredAt
+		jr := newQueuedJobResponse(job)
+		jr.DeadLetteredAt = &deadLetteredAt
+		response.DeadLettered = append(response.DeadLettered, jr)
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+//isQueued reports whether the job with the ID is waiting in the queue or in the delay queue
+func (ers *erServer) isQueued(id string) bool {
+	for _, job := range ers.jobQueue.List() {
+		if job.ID == id {
+			return true
+		}
+	}
+	for _, delayed := range ers.delayQueue.List() {
+		if delayed.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+//deleteQueuedJob cancels the run of a job waiting in the queue or in the delay queue,
+//which removes the job from the queue
+func (ers *erServer) deleteQueuedJob(w http.ResponseWriter, r *http.Request, id string) {
+	if !ers.isQueued(id) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(baseResponse{Message: fmt.Sprintf("Queued job %s not found", id)})
+		return
+	}
+	if err := ers.runCanceller.CancelRun(r.Context(), id); err != nil {
+		writeRunError(w, id, err)
+		return
+	}
+	klog.V(1).Infof("Removed queued job %s", id)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(baseResponse{Message: fmt.Sprintf("Removed queued job %s", id)})
+}
+
+func (ers *erServer) pauseQueue(w http.ResponseWriter, pause bool, runner string) {
+	target := "all runners"
+	if runner != "" {
+		target = "runner " + runner
+	}
+	if pause {
+		ers.jobQueue.Pause(runner)
+		klog.Infof("Paused dequeuing jobs of %s", target)
+	} else {
+		ers.jobQueue.Resume(runner)
+		klog.Infof("Resumed dequeuing jobs of %s", target)
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(ers.jobQueue.Paused())
+}
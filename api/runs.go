@@ -0,0 +1,174 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	queue "github.com/luqmanMohammed/k8s-events-runner/queue"
+	"github.com/luqmanMohammed/k8s-events-runner/runs"
+	"k8s.io/klog/v2"
+)
+
+const runsPath = "/api/v1/runs"
+
+//RunCanceller cancels queued, delayed and running runs
+type RunCanceller interface {
+	CancelRun(ctx context.Context, id string) error
+}
+
+//createRuns records a queued run for every job. Runs are created before the jobs are
+//queued, so that executors always find the run of a dequeued job.
+func (ers *erServer) createRuns(jobs []*queue.Job) {
+	for _, job := range jobs {
+		if err := ers.runStore.Create(runs.NewRun(job)); err != nil {
+			klog.Errorf("Failed to record run %s: %v", job.ID, err)
+		}
+	}
+}
+
+//deleteRuns removes the runs of jobs which could not be queued
+func (ers *erServer) deleteRuns(jobs []*queue.Job) {
+	for _, job := range jobs {
+		if err := ers.runStore.Delete(job.ID); err != nil && !errors.Is(err, runs.ErrRunNotFound) {
+			klog.Errorf("Failed to remove run %s: %v", job.ID, err)
+		}
+	}
+}
+
+//runsHandler serves the run history:
+//GET /api/v1/runs lists runs newest first, filtered by the runner, resource, eventType,
+//phase, since and until (RFC3339) query parameters and paginated with limit and continue,
+//GET /api/v1/runs/{id} returns the state of the run and
+//GET /api/v1/runs/{id}/logs returns the captured container logs of the run and
+//DELETE /api/v1/runs/{id} cancels the run
+func (ers *erServer) runsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, runsPath), "/"), "/")
+	if len(parts) > 2 || (len(parts) == 2 && parts[1] != "logs") {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if r.Method == http.MethodDelete && len(parts) == 1 && parts[0] != "" {
+		ers.cancelRun(w, r, parts[0])
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	switch {
+	case parts[0] == "":
+		ers.listRuns(w, r.URL.Query())
+	case len(parts) == 2:
+		ers.getRunLogs(w, parts[0])
+	default:
+		ers.getRun(w, parts[0])
+	}
+}
+
+//writeRunError writes the response for a failed run store operation
+func writeRunError(w http.ResponseWriter, id string, err error) {
+	if errors.Is(err, runs.ErrRunNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(baseResponse{Message: fmt.Sprintf("Run %s not found", id)})
+		return
+	}
+	if errors.Is(err, runs.ErrRunFinished) {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(baseResponse{Message: fmt.Sprintf("Run %s already finished", id)})
+		return
+	}
+	klog.Errorf("Run store operation for run %s failed: %v", id, err)
+	w.WriteHeader(http.StatusInternalServerError)
+	json.NewEncoder(w).Encode(baseResponse{Message: fmt.Sprintf("Run store operation failed: %v", err)})
+}
+
+func (ers *erServer) getRunLogs(w http.ResponseWriter, id string) {
+	logs, err := ers.runStore.GetLogs(id)
+	if err != nil {
+		writeRunError(w, id, err)
+		return
+	}
+	if logs == nil {
+		logs = []runs.ContainerLog{}
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(logs)
+}
+
+//parseListOptions parses the run list filters and pagination from the query parameters
+func parseListOptions(query url.Values) (runs.ListOptions, error) {
+	options := runs.ListOptions{
+		Runner:    query.Get("runner"),
+		Resource:  query.Get("resource"),
+		EventType: query.Get("eventType"),
+		Phase:     runs.Phase(query.Get("phase")),
+		Continue:  query.Get("continue"),
+	}
+	var err error
+	if since := query.Get("since"); since != "" {
+		if options.Since, err = time.Parse(time.RFC3339, since); err != nil {
+			return options, fmt.Errorf("invalid since: %v", err)
+		}
+	}
+	if until := query.Get("until"); until != "" {
+		if options.Until, err = time.Parse(time.RFC3339, until); err != nil {
+			return options, fmt.Errorf("invalid until: %v", err)
+		}
+	}
+	if limit := query.Get("limit"); limit != "" {
+		if options.Limit, err = strconv.Atoi(limit); err != nil || options.Limit < 0 {
+			return options, fmt.Errorf("invalid limit %q", limit)
+		}
+	}
+	return options, nil
+}
+
+func (ers *erServer) listRuns(w http.ResponseWriter, query url.Values) {
+	options, err := parseListOptions(query)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(baseResponse{Message: err.Error()})
+		return
+	}
+	result, err := ers.runStore.List(options)
+	if err != nil {
+		if errors.Is(err, runs.ErrInvalidContinue) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(baseResponse{Message: err.Error()})
+			return
+		}
+		klog.Errorf("Failed to list runs: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(baseResponse{Message: fmt.Sprintf("Failed to list runs: %v", err)})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(result)
+}
+
+func (ers *erServer) getRun(w http.ResponseWriter, id string) {
+	run, err := ers.runStore.Get(id)
+	if err != nil {
+		writeRunError(w, id, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(run)
+}
+
+//cancelRun cancels the run and returns its cancelled state
+func (ers *erServer) cancelRun(w http.ResponseWriter, r *http.Request, id string) {
+	if err := ers.runCanceller.CancelRun(r.Context(), id); err != nil {
+		writeRunError(w, id, err)
+		return
+	}
+	ers.getRun(w, id)
+}
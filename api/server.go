@@ -1,15 +1,20 @@
 package api
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/luqmanMohammed/k8s-events-runner/config"
 	queue "github.com/luqmanMohammed/k8s-events-runner/queue"
+	"github.com/luqmanMohammed/k8s-events-runner/runs"
 	"k8s.io/klog/v2"
 )
 
@@ -25,26 +30,84 @@ type baseResponse struct {
 	Message string `json:"message"`
 }
 
-//event is used to parse the request body which ideally should be a json respresentation of a k8s event
-type event struct {
-	EventType    string                 `json:"type"`
-	ResourseType string                 `json:"resourseType"`
-	Object       map[string]interface{} `json:"object"`
+//jobResponse describes a job created for an event. ID is also the ID of the run
+//of the job, see /api/v1/runs/{id}.
+type jobResponse struct {
+	ID        string `json:"id"`
+	Runner    string `json:"runner"`
+	Resource  string `json:"resource"`
+	EventType string `json:"eventType"`
+}
+
+//suppressedResponse describes a runner which was not triggered because the event is a
+//duplicate, along with the number of events suppressed in the current dedupe window
+type suppressedResponse struct {
+	Runner    string `json:"runner"`
+	DedupeKey string `json:"dedupeKey"`
+	Count     int    `json:"count"`
+}
+
+//eventResponse is the response to an event, listing every job created for it and
+//every runner suppressed as a duplicate
+type eventResponse struct {
+	baseResponse
+	Jobs       []jobResponse        `json:"jobs"`
+	Suppressed []suppressedResponse `json:"suppressed,omitempty"`
 }
 
 type erServer struct {
 	addr            string `default:":8080"`
 	serveMux        *http.ServeMux
-	jobQueue        *queue.JobQueue
+	jobQueue        queue.JobQueue
+	delayQueue      *queue.DelayQueue
+	deduplicator    *queue.Deduplicator
+	deadLetters     queue.DeadLetterStore
+	runStore        runs.Store
+	runCanceller    RunCanceller
 	configCollector config.ConfigCollector
+	enqueueTimeout  time.Duration `default:"5s"`
+	retryAfter      time.Duration `default:"30s"`
 }
 
-func New(addr string, jq *queue.JobQueue, cc config.ConfigCollector) *erServer {
+//Options contains the configuration and dependencies of the events runner server
+type Options struct {
+	//Addr is the address the server listens on
+	Addr string
+	//JobQueue receives the jobs of events, queued jobs can be inspected and removed
+	JobQueue queue.JobQueue
+	//DelayQueue holds delayed jobs which can be inspected and removed
+	DelayQueue *queue.DelayQueue
+	//Deduplicator suppresses repeated events of runners with dedupe configured
+	Deduplicator *queue.Deduplicator
+	//DeadLetters holds jobs which could not be dispatched, they can be inspected and replayed
+	DeadLetters queue.DeadLetterStore
+	//RunStore records the state of every queued job as a run
+	RunStore runs.Store
+	//RunCanceller cancels queued, delayed and dispatched runs
+	RunCanceller RunCanceller
+	//ConfigCollector provides the event map and runner templates events are matched against
+	ConfigCollector config.ConfigCollector
+	//EnqueueTimeout is the longest an event waits for space in a full job queue before
+	//it is rejected with 503 and a Retry-After of RetryAfter
+	EnqueueTimeout time.Duration
+	//RetryAfter is the delay clients are asked to wait before resending rejected events
+	RetryAfter time.Duration
+}
+
+//New instanciates the events runner server with the provided options
+func New(options Options) *erServer {
 	erSer := &erServer{
-		addr:            addr,
-		jobQueue:        jq,
-		configCollector: cc,
+		addr:            options.Addr,
+		jobQueue:        options.JobQueue,
+		delayQueue:      options.DelayQueue,
+		deduplicator:    options.Deduplicator,
+		deadLetters:     options.DeadLetters,
+		runStore:        options.RunStore,
+		runCanceller:    options.RunCanceller,
+		configCollector: options.ConfigCollector,
 		serveMux:        http.DefaultServeMux,
+		enqueueTimeout:  options.EnqueueTimeout,
+		retryAfter:      options.RetryAfter,
 	}
 	erSer.registerRoutes()
 	return erSer
@@ -88,6 +151,12 @@ func (ers erServer) ListenMTLS(caCertPath, serverKeyPath, serverCertPath string)
 func (ers *erServer) registerRoutes() {
 	ers.serveMux.HandleFunc("/api/v1/health", healthHandler)
 	ers.serveMux.HandleFunc("/api/v1/event", ers.eventHandler)
+	ers.serveMux.HandleFunc(deadLettersPath, ers.deadLettersHandler)
+	ers.serveMux.HandleFunc(deadLettersPath+"/", ers.deadLettersHandler)
+	ers.serveMux.HandleFunc(queuePath, ers.queueHandler)
+	ers.serveMux.HandleFunc(queuePath+"/", ers.queueHandler)
+	ers.serveMux.HandleFunc(runsPath, ers.runsHandler)
+	ers.serveMux.HandleFunc(runsPath+"/", ers.runsHandler)
 }
 
 func healthHandler(w http.ResponseWriter, r *http.Request) {
@@ -102,7 +171,8 @@ func (ers *erServer) eventHandler(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	} else {
-		var event event
+		//request body ideally should be a json respresentation of a k8s event
+		var event config.Event
 		body, err := ioutil.ReadAll(r.Body)
 		if err != nil {
 			w.WriteHeader(http.StatusBadRequest)
@@ -116,18 +186,102 @@ func (ers *erServer) eventHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		klog.V(1).Info("Received event", "event", event)
-		rva, err := ers.configCollector.GetRunnerConfigForResourceAndEvent(event.ResourseType, event.EventType)
+		if event.CallbackURL != "" {
+			if err := config.ValidateCallbackURL(event.CallbackURL); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(baseResponse{Message: fmt.Sprintf("Invalid callbackUrl: %v", err)})
+				return
+			}
+		}
+		rvas, err := ers.configCollector.GetRunnerConfigsForEvent(event)
 		if err != nil {
 			w.WriteHeader(http.StatusNotFound)
-			json.NewEncoder(w).Encode(baseResponse{Message: fmt.Sprintf("No Runner Config Found for %s:%s", event.ResourseType, event.EventType)})
+			json.NewEncoder(w).Encode(baseResponse{Message: fmt.Sprintf("No Runner Config Found for %s:%s", event.Resource, event.EventType)})
+			return
+		}
+		if len(rvas) == 0 {
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(eventResponse{
+				baseResponse: baseResponse{Message: fmt.Sprintf("Event %s:%s did not match any runner filters", event.Resource, event.EventType)},
+				Jobs:         []jobResponse{},
+			})
 			return
 		}
-		job := queue.Job{
-			RunnerConfig: rva,
-			EventType:    event.EventType,
-			Resource:     event.ResourseType,
+		//all runner configs are rendered before any job is queued, so that either all
+		//or none of the runners are triggered
+		rendered := make([]config.RunnerConfig, 0, len(rvas))
+		for _, rva := range rvas {
+			rrva, err := rva.Render(event)
+			if err != nil {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				json.NewEncoder(w).Encode(baseResponse{Message: fmt.Sprintf("Unable to render Runner Config %s for %s:%s: %v", rva.Runner, event.Resource, event.EventType, err)})
+				return
+			}
+			rendered = append(rendered, rrva)
+		}
+		response := eventResponse{Jobs: make([]jobResponse, 0, len(rendered))}
+		jobs, dedupeKeys := ers.dedupe(event, rendered, &response)
+		if len(jobs) == 0 {
+			response.Message = fmt.Sprintf("Event %s:%s was suppressed as a duplicate", event.Resource, event.EventType)
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+		response.Message = fmt.Sprintf("Created %d jobs for %s:%s", len(jobs), event.Resource, event.EventType)
+		ctx, cancel := context.WithTimeout(r.Context(), ers.enqueueTimeout)
+		defer cancel()
+		ers.createRuns(jobs)
+		if err := ers.jobQueue.Enqueue(ctx, jobs...); err != nil {
+			ers.deleteRuns(jobs)
+			//the event was not queued, so it must not suppress the next one
+			for _, key := range dedupeKeys {
+				ers.deduplicator.Forget(key)
+			}
+			if errors.Is(err, queue.ErrQueueFull) {
+				klog.V(1).Infof("Job queue is full, rejecting event %s:%s", event.Resource, event.EventType)
+				w.Header().Set("Retry-After", strconv.Itoa(int(ers.retryAfter.Seconds())))
+				w.WriteHeader(http.StatusServiceUnavailable)
+				json.NewEncoder(w).Encode(baseResponse{Message: "Job queue is full, retry later"})
+				return
+			}
+			klog.Errorf("Failed to enqueue jobs for %s:%s: %v", event.Resource, event.EventType, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(baseResponse{Message: fmt.Sprintf("Failed to enqueue jobs: %v", err)})
+			return
+		}
+		for _, job := range jobs {
+			response.Jobs = append(response.Jobs, newJobResponse(job))
 		}
-		ers.jobQueue.AddJob(&job)
 		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+//dedupe creates jobs for the rendered runner configs, skipping runners for which the
+//event is a duplicate. Suppressed runners are added to the response. The dedupe keys
+//of the created jobs are returned along with the jobs. If the dedupe key of a runner
+//cannot be rendered, the event is not deduplicated for that runner.
+func (ers *erServer) dedupe(event config.Event, rvas []config.RunnerConfig, response *eventResponse) ([]*queue.Job, []string) {
+	jobs := make([]*queue.Job, 0, len(rvas))
+	var dedupeKeys []string
+	for _, rva := range rvas {
+		if rva.Dedupe != nil {
+			key, err := rva.DedupeKey(event)
+			if err != nil {
+				klog.Errorf("Unable to render dedupe key of runner %s for %s:%s, not deduplicating: %v", rva.Runner, event.Resource, event.EventType, err)
+			} else if suppressed, count := ers.deduplicator.Suppress(rva.Runner, key, time.Duration(rva.Dedupe.Window)); suppressed {
+				klog.V(1).Infof("Suppressed duplicate event %s for runner %s, %d suppressed in window", key, rva.Runner, count)
+				response.Suppressed = append(response.Suppressed, suppressedResponse{
+					Runner:    rva.Runner,
+					DedupeKey: key,
+					Count:     count,
+				})
+				continue
+			} else {
+				dedupeKeys = append(dedupeKeys, key)
+			}
+		}
+		jobs = append(jobs, queue.NewJob(rva, event))
 	}
+	return jobs, dedupeKeys
 }
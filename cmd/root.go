@@ -28,11 +28,16 @@ import (
 	"time"
 
 	"github.com/luqmanMohammed/k8s-events-runner/api"
+	"github.com/luqmanMohammed/k8s-events-runner/config"
+	filecollector "github.com/luqmanMohammed/k8s-events-runner/config/file-collector"
 	k8sconfigmapcollector "github.com/luqmanMohammed/k8s-events-runner/config/k8s-configmap-collector"
+	k8scrdcollector "github.com/luqmanMohammed/k8s-events-runner/config/k8s-crd-collector"
 	"github.com/luqmanMohammed/k8s-events-runner/executor"
 	"github.com/luqmanMohammed/k8s-events-runner/queue"
+	"github.com/luqmanMohammed/k8s-events-runner/runs"
 	"github.com/luqmanMohammed/k8s-events-runner/utils"
 	"github.com/spf13/cobra"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/klog/v2"
 
 	"github.com/spf13/viper"
@@ -51,30 +56,79 @@ type Config struct {
 	IsLocal        bool
 	KubeConfigPath string
 	Namespace      string
+	//Config collector to use, either configmap, crd or file
+	ConfigCollector string
+	//File collector related configs
+	ConfigDir string
 	//Kubernetes configmap collector related configs
-	RunnerConfigMapLabel  string
-	EventMapConfigMapName string
+	RunnerConfigMapLabel   string
+	EventMapConfigMapLabel string
+	//Job queue related configs, QueueBackend is the name of a registered backend, e.g. memory or persistent
+	QueueBackend        string
+	QueuePath           string
+	QueueSize           int
+	QueueEnqueueTimeout time.Duration
+	QueueRetryAfter     time.Duration
+	QueueAgingInterval  time.Duration
+	//Dead-letter store related configs, DeadLetterBackend is either memory or persistent
+	DeadLetterBackend string
+	DeadLetterPath    string
+	//Run history related configs, RunStoreBackend is either memory or persistent. Finished
+	//runs are removed after RunRetention, checked every RunRetentionInterval.
+	RunStoreBackend      string
+	RunStorePath         string
+	RunRetention         time.Duration
+	RunRetentionInterval time.Duration
+	//Secret used to sign run completion callbacks with HMAC-SHA256, callbacks are not signed if empty
+	CallbackSecret string
+	//Dispatch retry related configs, jobs are dead-lettered after DispatchRetryLimit attempts
+	DispatchRetryLimit int
+	DispatchBackoff    time.Duration
+	DispatchMaxBackoff time.Duration
 	//Kubernetes event executor related configs
 	ExecutorPodIdentifier string
+	ExecutorCount         int
 	ConcurrencyTimeout    time.Duration
 	CleanupTimeout        time.Duration
+	//Maximum number of bytes of each runner container log kept with the run, 0 disables log capture
+	LogLimitBytes int
 }
 
 var (
 	defaults = map[string]interface{}{
-		"addr":                  ":8080",
-		"logVerbosity":          "3",
-		"isLocal":               true,
-		"kubeConfigPath":        "",
-		"namespace":             "er",
-		"runnerConfigMapLabel":  "er=runner",
-		"eventMapConfigMapName": "er-eventmap",
-		"caCertPath":            "./test_pki/ca/ca.crt",
-		"serverCertPath":        "./test_pki/server/server.crt",
-		"serverKeyPath":         "./test_pki/server/server.key",
-		"executorPodIdentifier": "er",
-		"concurrencyTimeout":    time.Minute * 5,
-		"cleanupTimeout":        time.Minute * 5,
+		"addr":                   ":8080",
+		"logVerbosity":           "3",
+		"isLocal":                true,
+		"kubeConfigPath":         "",
+		"namespace":              "er",
+		"configCollector":        "configmap",
+		"configDir":              "/etc/events-runner",
+		"runnerConfigMapLabel":   "er=runner",
+		"eventMapConfigMapLabel": "er=eventmap",
+		"caCertPath":             "./test_pki/ca/ca.crt",
+		"serverCertPath":         "./test_pki/server/server.crt",
+		"serverKeyPath":          "./test_pki/server/server.key",
+		"queueBackend":           "memory",
+		"queuePath":              "/var/lib/events-runner/queue.db",
+		"queueSize":              50,
+		"queueEnqueueTimeout":    time.Second * 5,
+		"queueRetryAfter":        time.Second * 30,
+		"queueAgingInterval":     time.Minute,
+		"deadLetterBackend":      "memory",
+		"deadLetterPath":         "/var/lib/events-runner/deadletters.db",
+		"runStoreBackend":        "memory",
+		"runStorePath":           "/var/lib/events-runner/runs.db",
+		"runRetention":           time.Hour * 24 * 7,
+		"runRetentionInterval":   time.Minute * 10,
+		"callbackSecret":         "",
+		"dispatchRetryLimit":     5,
+		"dispatchBackoff":        time.Second * 5,
+		"dispatchMaxBackoff":     time.Minute * 5,
+		"executorPodIdentifier":  "er",
+		"executorCount":          5,
+		"concurrencyTimeout":     time.Minute * 5,
+		"cleanupTimeout":         time.Minute * 5,
+		"logLimitBytes":          64 * 1024,
 	}
 )
 
@@ -95,29 +149,133 @@ var rootCmd = &cobra.Command{
 		if err != nil {
 			klog.Fatalf("Error Initializing Kube Connection: %v", err)
 		}
-		k8scmc := k8sconfigmapcollector.New(kubeclientset, config.Namespace, config.RunnerConfigMapLabel, config.EventMapConfigMapName)
-		if err = k8scmc.Collect(); err != nil {
-			klog.Fatalf("Error collecting configmaps: %v", err)
+		configCollector, err := newConfigCollector(config, kubeclientset)
+		if err != nil {
+			klog.Fatalf("Error initializing config collector: %v", err)
+		}
+		if err = configCollector.Collect(); err != nil {
+			klog.Fatalf("Error collecting configs: %v", err)
+		}
+		if err = configCollector.Watch(context.Background()); err != nil {
+			klog.Fatalf("Error watching configs: %v", err)
 		}
 		klog.V(1).Info("Starting Events Runner Server")
-		jq := queue.NewJobQueue(50)
-		exec := executor.New(kubeclientset, config.Namespace, config.ExecutorPodIdentifier, config.ConcurrencyTimeout, config.CleanupTimeout, jq)
+		jq, err := queue.New(config.QueueBackend, queue.Options{
+			Size:          config.QueueSize,
+			Path:          config.QueuePath,
+			AgingInterval: config.QueueAgingInterval,
+			Capacity:      config.ExecutorCount,
+		})
+		if err != nil {
+			klog.Fatalf("Error initializing job queue: %v", err)
+		}
+		queue.PublishMetrics("jobQueue", jq)
+		deadLetters, err := newDeadLetterStore(config)
+		if err != nil {
+			klog.Fatalf("Error initializing dead-letter store: %v", err)
+		}
+		delayQueue := queue.NewDelayQueue(jq)
+		runStore, err := newRunStore(config)
+		if err != nil {
+			klog.Fatalf("Error initializing run store: %v", err)
+		}
+		go runs.RunRetention(context.Background(), runStore, config.RunRetention, config.RunRetentionInterval)
+		exec := executor.New(kubeclientset, executor.Options{
+			Namespace:          config.Namespace,
+			PodIdentifier:      config.ExecutorPodIdentifier,
+			ExecutorCount:      config.ExecutorCount,
+			ConcurrencyTimeout: config.ConcurrencyTimeout,
+			CleanupTimeout:     config.CleanupTimeout,
+			JobQueue:           jq,
+			DelayQueue:         delayQueue,
+			DeadLetters:        deadLetters,
+			RunStore:           runStore,
+			RetryPolicy: executor.RetryPolicy{
+				Limit:      config.DispatchRetryLimit,
+				Backoff:    config.DispatchBackoff,
+				MaxBackoff: config.DispatchMaxBackoff,
+			},
+			LogLimitBytes: config.LogLimitBytes,
+		})
 
-		// go func() {
-		// 	exec.StartWatcher(context.Background())
-		// }()
+		exec.StartJobWatcher(context.Background())
 
 		go func() {
 			exec.StartExecutors(context.Background())
 		}()
 
-		erServer := api.New(config.Addr, &jq, k8scmc)
+		erServer := api.New(api.Options{
+			Addr:            config.Addr,
+			JobQueue:        jq,
+			DelayQueue:      delayQueue,
+			Deduplicator:    queue.NewDeduplicator("suppressedEvents"),
+			DeadLetters:     deadLetters,
+			RunStore:        runStore,
+			RunCanceller:    exec,
+			ConfigCollector: configCollector,
+			EnqueueTimeout:  config.QueueEnqueueTimeout,
+			RetryAfter:      config.QueueRetryAfter,
+		})
 		if err = erServer.ListenMTLS(config.CACertPath, config.ServerKeyPath, config.ServerCertPath); err != nil {
 			klog.Fatalf("Error starting server: %v", err)
 		}
 	},
 }
 
+//newConfigCollector creates the config collector selected by the ConfigCollector config
+func newConfigCollector(erConfig Config, kubeclientset *kubernetes.Clientset) (config.ConfigCollector, error) {
+	switch erConfig.ConfigCollector {
+	case "configmap":
+		//eventMapConfigMapName selected a single ConfigMap by name, which cannot be
+		//translated into a label selector
+		if viper.IsSet("eventMapConfigMapName") {
+			return nil, fmt.Errorf("eventMapConfigMapName (ER_EVENTMAPCONFIGMAPNAME) was replaced by eventMapConfigMapLabel (ER_EVENTMAPCONFIGMAPLABEL), label the eventMap ConfigMaps with it, e.g. %q, and unset eventMapConfigMapName", defaults["eventMapConfigMapLabel"])
+		}
+		return k8sconfigmapcollector.New(kubeclientset, erConfig.Namespace, erConfig.RunnerConfigMapLabel, erConfig.EventMapConfigMapLabel), nil
+	case "crd":
+		dynamicClient, err := utils.GetKubeDynamicClient(erConfig.IsLocal, erConfig.KubeConfigPath)
+		if err != nil {
+			return nil, err
+		}
+		return k8scrdcollector.New(dynamicClient, erConfig.Namespace), nil
+	case "file":
+		return filecollector.New(erConfig.ConfigDir), nil
+	default:
+		return nil, fmt.Errorf("unknown config collector %q", erConfig.ConfigCollector)
+	}
+}
+
+//newDeadLetterStore creates the dead-letter store selected by the DeadLetterBackend config
+func newDeadLetterStore(erConfig Config) (queue.DeadLetterStore, error) {
+	switch erConfig.DeadLetterBackend {
+	case "memory":
+		return queue.NewMemoryDeadLetterStore(), nil
+	case "persistent":
+		return queue.NewPersistentDeadLetterStore(erConfig.DeadLetterPath)
+	default:
+		return nil, fmt.Errorf("unknown dead-letter backend %q", erConfig.DeadLetterBackend)
+	}
+}
+
+//newRunStore creates the run store selected by the RunStoreBackend config, which calls
+//the completion callbacks of runs
+func newRunStore(erConfig Config) (runs.Store, error) {
+	var store runs.Store
+	switch erConfig.RunStoreBackend {
+	case "memory":
+		store = runs.NewMemoryStore()
+	case "persistent":
+		boltStore, err := runs.NewBoltStore(erConfig.RunStorePath)
+		if err != nil {
+			return nil, err
+		}
+		store = boltStore
+	default:
+		return nil, fmt.Errorf("unknown run store backend %q", erConfig.RunStoreBackend)
+	}
+	return runs.NewCallbackStore(store, []byte(erConfig.CallbackSecret)), nil
+}
+
 //Execute triggers the root cmd
 func Execute() {
 	cobra.CheckErr(rootCmd.Execute())
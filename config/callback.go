@@ -0,0 +1,65 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+const (
+	//DefaultCallbackTimeout is the timeout of a single callback request if none is configured
+	DefaultCallbackTimeout = 10 * time.Second
+	//DefaultCallbackRetries is the number of retries of a failed callback if none is configured
+	DefaultCallbackRetries = 3
+)
+
+//CallbackConfig configures the callback which is called with the outcome of a run once
+//its kubernetes Job finished. A callback URL set on the event takes precedence over URL.
+type CallbackConfig struct {
+	URL     string   `yaml:"url" json:"url,omitempty"`
+	Timeout Duration `yaml:"timeout" json:"timeout,omitempty"`
+	Retries *int     `yaml:"retries" json:"retries,omitempty"`
+}
+
+//ValidateCallbackURL checks that the callback URL is an absolute http or https URL
+func ValidateCallbackURL(callbackURL string) error {
+	parsed, err := url.Parse(callbackURL)
+	if err != nil {
+		return err
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("callback URL %q must be an absolute http or https URL", callbackURL)
+	}
+	return nil
+}
+
+//validate checks the callback URL, timeout and retries
+func (cc *CallbackConfig) validate(field string, addErr func(field, reason string)) {
+	if cc.URL != "" {
+		if err := ValidateCallbackURL(cc.URL); err != nil {
+			addErr(field+".url", err.Error())
+		}
+	}
+	if cc.Timeout < 0 {
+		addErr(field+".timeout", "must not be negative")
+	}
+	if cc.Retries != nil && *cc.Retries < 0 {
+		addErr(field+".retries", "must not be negative")
+	}
+}
+
+//CallbackTimeout returns the configured timeout of a single callback request or the default
+func (cc *CallbackConfig) CallbackTimeout() time.Duration {
+	if cc == nil || cc.Timeout == 0 {
+		return DefaultCallbackTimeout
+	}
+	return time.Duration(cc.Timeout)
+}
+
+//CallbackRetries returns the configured number of retries of a failed callback or the default
+func (cc *CallbackConfig) CallbackRetries() int {
+	if cc == nil || cc.Retries == nil {
+		return DefaultCallbackRetries
+	}
+	return *cc.Retries
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"context"
 	"errors"
 
 	v1 "k8s.io/api/core/v1"
@@ -13,21 +14,76 @@ var (
 //ConfigCollector interface should be implemented by all config collectors
 type ConfigCollector interface {
 	Collect() error
-	GetRunnerConfigForResourceAndEvent(resource, event string) (RunnerConfig, error)
+	Watch(ctx context.Context) error
+	GetRunnerConfigsForEvent(event Event) ([]RunnerConfig, error)
 }
 
 //RunnerTemplate is a template for a pod runner configuration
 type RunnerTemplate v1.PodTemplateSpec
 
-//EventMap maps and resource:event to a runner
-type EventMap map[string]map[string]RunnerSelector
+//EventMap maps and resource:event to one or more runners
+type EventMap map[string]map[string]RunnerSelectors
 
-//RunnerSelector contains the runner name and event specific information
-//TODO: Add simple event specific overides for runner configuration
+//RunnerSelectors is the list of runners triggered by a resource:event.
+//In the eventMap config it can be a list of selectors or a single selector.
+type RunnerSelectors []RunnerSelector
+
+//UnmarshalYAML unmarshals either a list of runner selectors or a single runner selector
+func (rs *RunnerSelectors) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var runnerSelectors []RunnerSelector
+	if err := unmarshal(&runnerSelectors); err == nil {
+		*rs = runnerSelectors
+		return nil
+	}
+	var runnerSelector RunnerSelector
+	if err := unmarshal(&runnerSelector); err != nil {
+		return err
+	}
+	*rs = RunnerSelectors{runnerSelector}
+	return nil
+}
+
+//RunnerSelector contains the runner name and event specific information, including
+//overrides which are merged onto the runner template and a filter which limits the
+//events that trigger the runner. Jobs with a higher Priority are dequeued first.
+//Repeated events are collapsed into a single job if Dedupe is configured. Jobs of the
+//same priority are shared between resources, or between the values of TenantLabel on
+//the event object, in proportion to Weight. Callback is called with the outcome of
+//every run of the runner.
 type RunnerSelector struct {
-	Runner           string `yaml:"runner"`
-	ConcurrencyLimit int    `yaml:"concurrencyLimit" default:"-1"`
-	RetryLimit       int    `yaml:"retryLimit" default:"0"`
+	Runner           string           `yaml:"runner" json:"runner,omitempty"`
+	ConcurrencyLimit int              `yaml:"concurrencyLimit" json:"concurrencyLimit,omitempty"`
+	RetryLimit       int              `yaml:"retryLimit" json:"retryLimit,omitempty"`
+	Priority         int              `yaml:"priority" json:"priority,omitempty"`
+	Weight           int              `yaml:"weight" json:"weight,omitempty"`
+	TenantLabel      string           `yaml:"tenantLabel" json:"tenantLabel,omitempty"`
+	Overrides        *RunnerOverrides `yaml:"overrides" json:"overrides,omitempty"`
+	Filter           *EventFilter     `yaml:"filter" json:"filter,omitempty"`
+	Dedupe           *DedupeConfig    `yaml:"dedupe" json:"dedupe,omitempty"`
+	Callback         *CallbackConfig  `yaml:"callback" json:"callback,omitempty"`
+}
+
+//UnmarshalYAML unmarshals the runner selector. Omitted fields default to the values
+//the EventRunner CRD defaults them to, ConcurrencyLimit to -1 (unlimited) and Weight
+//to 1, so that selectors behave the same with every config collector.
+func (rs *RunnerSelector) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain RunnerSelector
+	runnerSelector := plain{ConcurrencyLimit: -1, Weight: 1}
+	if err := unmarshal(&runnerSelector); err != nil {
+		return err
+	}
+	*rs = RunnerSelector(runnerSelector)
+	return nil
+}
+
+//Event is the json representation of a k8s event which triggers runners.
+//Object is the full kubernetes resource the event was raised for. CallbackURL is
+//called with the outcome of every run triggered by the event.
+type Event struct {
+	EventType   string                 `json:"type"`
+	Resource    string                 `json:"resourseType"`
+	Object      map[string]interface{} `json:"object"`
+	CallbackURL string                 `json:"callbackUrl,omitempty"`
 }
 
 //RunnerConfig contains actual runner template and event specific information
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+//DefaultDedupeKey identifies repeated events of the same object by resource, event type and object UID
+const DefaultDedupeKey = "{{ .Resource }}/{{ .EventType }}/{{ .Object.metadata.uid }}"
+
+//Duration is a time.Duration which is configured as a duration string, e.g. 30s or 5m
+type Duration time.Duration
+
+//UnmarshalYAML parses the duration from a duration string
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value string
+	if err := unmarshal(&value); err != nil {
+		return err
+	}
+	return d.parse(value)
+}
+
+//UnmarshalJSON parses the duration from a duration string
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	return d.parse(value)
+}
+
+//MarshalJSON formats the duration as a duration string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) parse(value string) error {
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(duration)
+	return nil
+}
+
+//DedupeConfig collapses repeated events into a single job. Events which render to the
+//same Key within Window of the first event are suppressed. Key is a go template with the
+//event as data and defaults to DefaultDedupeKey.
+type DedupeConfig struct {
+	Window Duration `yaml:"window" json:"window"`
+	Key    string   `yaml:"key" json:"key,omitempty"`
+}
+
+//key returns the configured key template or the default key template
+func (dc *DedupeConfig) key() string {
+	if dc.Key == "" {
+		return DefaultDedupeKey
+	}
+	return dc.Key
+}
+
+//validate checks the window and that the key template can be parsed
+func (dc *DedupeConfig) validate(field string, addErr func(field, reason string)) {
+	if dc.Window <= 0 {
+		addErr(field+".window", "must be greater than 0")
+	}
+	if _, err := parseTemplate(field+".key", dc.key()); err != nil {
+		addErr(field+".key", fmt.Sprintf("invalid template: %v", err))
+	}
+}
+
+//DedupeKey renders the dedupe key of the RunnerConfig for the event. The runner name is
+//part of the key, so that runners triggered by the same event are deduplicated separately.
+func (rc RunnerConfig) DedupeKey(event Event) (string, error) {
+	if rc.Dedupe == nil {
+		return "", fmt.Errorf("dedupe is not configured for runner %s", rc.Runner)
+	}
+	key, err := renderValue("dedupe.key", rc.Dedupe.key(), event)
+	if err != nil {
+		return "", err
+	}
+	return rc.Runner + "/" + key, nil
+}
@@ -0,0 +1,218 @@
+package filecollector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	config "github.com/luqmanMohammed/k8s-events-runner/config"
+	"gopkg.in/yaml.v2"
+	v1 "k8s.io/api/core/v1"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/klog/v2"
+)
+
+const (
+	//runnersDir is the sub directory of the config directory which contains runner templates
+	runnersDir = "runners"
+	//eventMapsDir is the sub directory of the config directory which contains eventMaps
+	eventMapsDir = "eventmaps"
+	//reloadDelay is the time to wait for file changes to settle before reloading
+	reloadDelay = 500 * time.Millisecond
+)
+
+//FileCollector implents ConfigCollector interface and adds functionality
+//to get configs from files in a local directory. Runner templates are read from
+//the runners sub directory, one YAML or JSON Pod or PodTemplateSpec per file, with
+//the file name without extension used as the runner name. EventMaps are read from
+//all files in the eventmaps sub directory and merged.
+type FileCollector struct {
+	configDir string
+	config.Store
+}
+
+//New instanciates a FileCollector object
+func New(configDir string) *FileCollector {
+	return &FileCollector{
+		configDir: configDir,
+	}
+}
+
+//readConfigFiles reads all YAML and JSON files in the sub directory of the config
+//directory. Hidden files, such as the ..data links of mounted ConfigMaps, are skipped.
+func (fc *FileCollector) readConfigFiles(subDir string) (map[string][]byte, error) {
+	dir := filepath.Join(fc.configDir, subDir)
+	fileInfos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string][]byte)
+	for _, fileInfo := range fileInfos {
+		name := fileInfo.Name()
+		if strings.HasPrefix(name, ".") || fileInfo.IsDir() {
+			continue
+		}
+		switch filepath.Ext(name) {
+		case ".yaml", ".yml", ".json":
+		default:
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		files[filepath.Join(subDir, name)] = data
+	}
+	return files, nil
+}
+
+//sortedFileNames returns the file names in sorted order so configs are loaded deterministically
+func sortedFileNames(files map[string][]byte) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//parseRunnerTemplate parses a YAML or JSON Pod, PodTemplate or PodTemplateSpec
+func parseRunnerTemplate(data []byte) (*config.RunnerTemplate, error) {
+	jsonData, err := k8syaml.ToJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	var podTemplate v1.PodTemplate
+	if err := json.Unmarshal(jsonData, &podTemplate); err != nil {
+		return nil, err
+	}
+	if podTemplate.Kind == "PodTemplate" {
+		runnerTemplate := config.RunnerTemplate(podTemplate.Template)
+		return &runnerTemplate, nil
+	}
+	var pod v1.Pod
+	if err := json.Unmarshal(jsonData, &pod); err != nil {
+		return nil, err
+	}
+	runnerTemplate := config.RunnerTemplate(v1.PodTemplateSpec{
+		ObjectMeta: pod.ObjectMeta,
+		Spec:       pod.Spec,
+	})
+	return &runnerTemplate, nil
+}
+
+//parseRunnerTemplates parses and validates runner templates from the provided files
+func parseRunnerTemplates(runnerFiles map[string][]byte) (map[string]*config.RunnerTemplate, config.ValidationErrors) {
+	var errs config.ValidationErrors
+	runnerTemplates := make(map[string]*config.RunnerTemplate)
+	for _, fileName := range sortedFileNames(runnerFiles) {
+		runnerName := strings.TrimSuffix(filepath.Base(fileName), filepath.Ext(fileName))
+		if _, ok := runnerTemplates[runnerName]; ok {
+			errs = append(errs, config.ValidationError{ConfigMap: fileName, Reason: fmt.Sprintf("runner template %q is defined in more than one file", runnerName)})
+			continue
+		}
+		runnerTemplate, err := parseRunnerTemplate(runnerFiles[fileName])
+		if err != nil {
+			errs = append(errs, config.ValidationError{ConfigMap: fileName, Reason: fmt.Sprintf("invalid pod template: %v", err)})
+			continue
+		}
+		errs = append(errs, config.ValidateRunnerTemplate(fileName, "", runnerTemplate)...)
+		runnerTemplates[runnerName] = runnerTemplate
+	}
+	return runnerTemplates, errs
+}
+
+//parseEventMaps parses and validates the eventMaps from the provided files against
+//the provided runner templates, and merges them into a single eventMap
+func parseEventMaps(eventMapFiles map[string][]byte, runnerTemplates map[string]*config.RunnerTemplate) (config.EventMap, config.ValidationErrors) {
+	var errs config.ValidationErrors
+	sources := make([]config.EventMapSource, 0, len(eventMapFiles))
+	for _, fileName := range sortedFileNames(eventMapFiles) {
+		var eventMapConfig config.EventMap
+		if err := yaml.Unmarshal(eventMapFiles[fileName], &eventMapConfig); err != nil {
+			errs = append(errs, config.ValidationError{ConfigMap: fileName, Reason: fmt.Sprintf("invalid eventMap config: %v", err)})
+			continue
+		}
+		errs = append(errs, config.ValidateEventMap(fileName, "", eventMapConfig, runnerTemplates)...)
+		sources = append(sources, config.EventMapSource{ConfigMap: fileName, EventMap: eventMapConfig})
+	}
+	eventMap, mergeErrs := config.MergeEventMaps(sources)
+	return eventMap, append(errs, mergeErrs...)
+}
+
+//Collect reads runner templates and eventMaps from the config directory. Both configs
+//are validated before being used, and the current config is kept if they are invalid.
+func (fc *FileCollector) Collect() error {
+	runnerFiles, err := fc.readConfigFiles(runnersDir)
+	if err != nil {
+		klog.Errorf("Error when collecting runner templates %v", err)
+		return err
+	}
+	eventMapFiles, err := fc.readConfigFiles(eventMapsDir)
+	if err != nil {
+		klog.Errorf("Error when collecting eventMap Config %v", err)
+		return err
+	}
+	runnerTemplates, errs := parseRunnerTemplates(runnerFiles)
+	eventMap, eventMapErrs := parseEventMaps(eventMapFiles, runnerTemplates)
+	if errs = append(errs, eventMapErrs...); len(errs) > 0 {
+		klog.Errorf("Unable to collect configs. Invalid Config: %v", errs)
+		return errs
+	}
+	fc.Swap(runnerTemplates, eventMap)
+	klog.V(1).Infof("Succesffully collected %d Runner Templates and %d EventMaps from %s", len(runnerFiles), len(eventMapFiles), fc.configDir)
+	return nil
+}
+
+//Watch watches the runners and eventmaps directories and re-collects configs whenever
+//files in them change. Changes are batched for a short delay, since editors and
+//ConfigMap volume updates usually cause several file events for a single change.
+func (fc *FileCollector) Watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	for _, subDir := range []string{runnersDir, eventMapsDir} {
+		if err := watcher.Add(filepath.Join(fc.configDir, subDir)); err != nil {
+			watcher.Close()
+			return err
+		}
+	}
+	go func() {
+		defer watcher.Close()
+		reloadTimer := time.NewTimer(reloadDelay)
+		reloadTimer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				reloadTimer.Stop()
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				klog.V(3).Infof("Config file event: %s", event)
+				reloadTimer.Reset(reloadDelay)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				klog.Errorf("Error watching config files: %v", err)
+			case <-reloadTimer.C:
+				if err := fc.Collect(); err != nil {
+					klog.Error("Unable to reload configs, keeping existing config")
+					continue
+				}
+				klog.V(1).Infof("Reloaded configs from %s", fc.configDir)
+			}
+		}
+	}()
+	klog.V(1).Infof("Watching %s for config changes", fc.configDir)
+	return nil
+}
@@ -0,0 +1,164 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+//Field filter operators
+const (
+	FilterOpIn           = "In"
+	FilterOpNotIn        = "NotIn"
+	FilterOpExists       = "Exists"
+	FilterOpDoesNotExist = "DoesNotExist"
+)
+
+//EventFilter limits the events which trigger a runner based on the event object.
+//An event has to match all of the configured conditions. Filters are compiled
+//when the eventMap is validated.
+type EventFilter struct {
+	Namespaces        []string      `yaml:"namespaces" json:"namespaces,omitempty"`
+	ExcludeNamespaces []string      `yaml:"excludeNamespaces" json:"excludeNamespaces,omitempty"`
+	LabelSelector     string        `yaml:"labelSelector" json:"labelSelector,omitempty"`
+	Fields            []FieldFilter `yaml:"fields" json:"fields,omitempty"`
+	labelSelector     labels.Selector
+}
+
+//FieldFilter matches a field of the event object selected by a JSONPath expression,
+//wrapped in braces, e.g. {.status.phase} with operator In and values [Failed]
+type FieldFilter struct {
+	Path     string   `yaml:"path" json:"path"`
+	Operator string   `yaml:"operator" json:"operator,omitempty"`
+	Values   []string `yaml:"values" json:"values,omitempty"`
+	compiled *compiledJSONPath
+}
+
+//compiledJSONPath guards a parsed JSONPath, which is not safe for concurrent use
+type compiledJSONPath struct {
+	mutex    sync.Mutex
+	jsonPath *jsonpath.JSONPath
+}
+
+//compile validates the filter and compiles its label selector and JSONPath expressions
+func (ef *EventFilter) compile(field string, addErr func(field, reason string)) {
+	labelSelector, err := labels.Parse(ef.LabelSelector)
+	if err != nil {
+		addErr(field+".labelSelector", err.Error())
+	}
+	ef.labelSelector = labelSelector
+	for i := range ef.Fields {
+		ff := &ef.Fields[i]
+		fieldFilterField := fmt.Sprintf("%s.fields[%d]", field, i)
+		if ff.Operator == "" {
+			ff.Operator = FilterOpIn
+		}
+		switch ff.Operator {
+		case FilterOpIn, FilterOpNotIn:
+			if len(ff.Values) == 0 {
+				addErr(fieldFilterField+".values", fmt.Sprintf("at least one value is required for operator %s", ff.Operator))
+			}
+		case FilterOpExists, FilterOpDoesNotExist:
+			if len(ff.Values) != 0 {
+				addErr(fieldFilterField+".values", fmt.Sprintf("values must be empty for operator %s", ff.Operator))
+			}
+		default:
+			addErr(fieldFilterField+".operator", fmt.Sprintf("unknown operator %q", ff.Operator))
+		}
+		//paths without braces parse as literal text, which never selects a field
+		if path := strings.TrimSpace(ff.Path); !strings.HasPrefix(path, "{") || !strings.HasSuffix(path, "}") {
+			addErr(fieldFilterField+".path", fmt.Sprintf("JSONPath %q must be wrapped in braces, e.g. {.status.phase}", ff.Path))
+			continue
+		}
+		jsonPath := jsonpath.New(fieldFilterField).AllowMissingKeys(true)
+		if err := jsonPath.Parse(ff.Path); err != nil {
+			addErr(fieldFilterField+".path", fmt.Sprintf("invalid JSONPath: %v", err))
+			continue
+		}
+		ff.compiled = &compiledJSONPath{jsonPath: jsonPath}
+	}
+}
+
+//Matches reports whether the event matches all conditions of the filter.
+//A filter which failed to compile never matches.
+func (ef *EventFilter) Matches(event Event) bool {
+	metadata, _ := event.Object["metadata"].(map[string]interface{})
+	namespace, _ := metadata["namespace"].(string)
+	if len(ef.Namespaces) > 0 && !containsString(ef.Namespaces, namespace) {
+		return false
+	}
+	if containsString(ef.ExcludeNamespaces, namespace) {
+		return false
+	}
+	if ef.labelSelector == nil {
+		return false
+	}
+	if !ef.labelSelector.Empty() {
+		objLabels := make(labels.Set)
+		rawLabels, _ := metadata["labels"].(map[string]interface{})
+		for k, v := range rawLabels {
+			objLabels[k] = fmt.Sprint(v)
+		}
+		if !ef.labelSelector.Matches(objLabels) {
+			return false
+		}
+	}
+	for i := range ef.Fields {
+		if !ef.Fields[i].matches(event.Object) {
+			return false
+		}
+	}
+	return true
+}
+
+//matches reports whether the field selected by the JSONPath matches the filter
+func (ff *FieldFilter) matches(obj map[string]interface{}) bool {
+	if ff.compiled == nil {
+		return false
+	}
+	ff.compiled.mutex.Lock()
+	results, err := ff.compiled.jsonPath.FindResults(obj)
+	ff.compiled.mutex.Unlock()
+	if err != nil {
+		return false
+	}
+	var values []string
+	for _, result := range results {
+		for _, value := range result {
+			if value.Kind() == reflect.Interface && value.IsNil() {
+				continue
+			}
+			values = append(values, fmt.Sprint(value.Interface()))
+		}
+	}
+	switch ff.Operator {
+	case FilterOpExists:
+		return len(values) > 0
+	case FilterOpDoesNotExist:
+		return len(values) == 0
+	case FilterOpIn, FilterOpNotIn:
+		found := false
+		for _, value := range values {
+			if containsString(ff.Values, value) {
+				found = true
+				break
+			}
+		}
+		return found == (ff.Operator == FilterOpIn)
+	}
+	return false
+}
+
+//containsString reports whether the slice contains the string
+func containsString(slice []string, s string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,180 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEventFilterMatches(t *testing.T) {
+	event := Event{
+		EventType: "MODIFIED",
+		Resource:  "pods",
+		Object: map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"name":      "web-0",
+				"namespace": "default",
+				"labels":    map[string]interface{}{"app": "web", "tier": "frontend"},
+			},
+			"status": map[string]interface{}{
+				"phase":    "Failed",
+				"reason":   nil,
+				"restarts": 3,
+			},
+		},
+	}
+	tests := []struct {
+		name   string
+		filter EventFilter
+		want   bool
+	}{
+		{
+			name: "empty filter",
+			want: true,
+		},
+		{
+			name:   "namespace listed",
+			filter: EventFilter{Namespaces: []string{"kube-system", "default"}},
+			want:   true,
+		},
+		{
+			name:   "namespace not listed",
+			filter: EventFilter{Namespaces: []string{"kube-system"}},
+			want:   false,
+		},
+		{
+			name:   "namespace excluded",
+			filter: EventFilter{ExcludeNamespaces: []string{"default"}},
+			want:   false,
+		},
+		{
+			name:   "label selector matches",
+			filter: EventFilter{LabelSelector: "app=web,tier in (frontend,backend)"},
+			want:   true,
+		},
+		{
+			name:   "label selector does not match",
+			filter: EventFilter{LabelSelector: "app!=web"},
+			want:   false,
+		},
+		{
+			name:   "operator defaults to In",
+			filter: EventFilter{Fields: []FieldFilter{{Path: "{.status.phase}", Values: []string{"Failed", "Unknown"}}}},
+			want:   true,
+		},
+		{
+			name:   "In with other values",
+			filter: EventFilter{Fields: []FieldFilter{{Path: "{.status.phase}", Operator: FilterOpIn, Values: []string{"Running"}}}},
+			want:   false,
+		},
+		{
+			name:   "In compares formatted values",
+			filter: EventFilter{Fields: []FieldFilter{{Path: "{.status.restarts}", Values: []string{"3"}}}},
+			want:   true,
+		},
+		{
+			name:   "NotIn",
+			filter: EventFilter{Fields: []FieldFilter{{Path: "{.status.phase}", Operator: FilterOpNotIn, Values: []string{"Running"}}}},
+			want:   true,
+		},
+		{
+			name:   "NotIn with the value",
+			filter: EventFilter{Fields: []FieldFilter{{Path: "{.status.phase}", Operator: FilterOpNotIn, Values: []string{"Failed"}}}},
+			want:   false,
+		},
+		{
+			name:   "NotIn with a missing field",
+			filter: EventFilter{Fields: []FieldFilter{{Path: "{.status.message}", Operator: FilterOpNotIn, Values: []string{"Failed"}}}},
+			want:   true,
+		},
+		{
+			name:   "Exists",
+			filter: EventFilter{Fields: []FieldFilter{{Path: "{.metadata.name}", Operator: FilterOpExists}}},
+			want:   true,
+		},
+		{
+			name:   "Exists with a missing field",
+			filter: EventFilter{Fields: []FieldFilter{{Path: "{.status.message}", Operator: FilterOpExists}}},
+			want:   false,
+		},
+		{
+			name:   "DoesNotExist with a null field",
+			filter: EventFilter{Fields: []FieldFilter{{Path: "{.status.reason}", Operator: FilterOpDoesNotExist}}},
+			want:   true,
+		},
+		{
+			name:   "DoesNotExist with the field",
+			filter: EventFilter{Fields: []FieldFilter{{Path: "{.status.phase}", Operator: FilterOpDoesNotExist}}},
+			want:   false,
+		},
+		{
+			name: "all conditions have to match",
+			filter: EventFilter{
+				Namespaces:    []string{"default"},
+				LabelSelector: "app=web",
+				Fields: []FieldFilter{
+					{Path: "{.status.phase}", Values: []string{"Failed"}},
+					{Path: "{.metadata.deletionTimestamp}", Operator: FilterOpExists},
+				},
+			},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.filter.compile("filter", func(field, reason string) {
+				t.Fatalf("compile() error %s: %s", field, reason)
+			})
+			if got := tt.filter.Matches(event); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEventFilterCompileErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter EventFilter
+		want   []string
+	}{
+		{
+			name:   "invalid label selector",
+			filter: EventFilter{LabelSelector: "app in web"},
+			want:   []string{"filter.labelSelector"},
+		},
+		{
+			name:   "path without braces",
+			filter: EventFilter{Fields: []FieldFilter{{Path: ".status.phase", Values: []string{"Failed"}}}},
+			want:   []string{"filter.fields[0].path"},
+		},
+		{
+			name:   "invalid path",
+			filter: EventFilter{Fields: []FieldFilter{{Path: "{.status[}", Values: []string{"Failed"}}}},
+			want:   []string{"filter.fields[0].path"},
+		},
+		{
+			name: "values of operators",
+			filter: EventFilter{Fields: []FieldFilter{
+				{Path: "{.status.phase}", Operator: FilterOpNotIn},
+				{Path: "{.status.phase}", Operator: FilterOpExists, Values: []string{"Failed"}},
+			}},
+			want: []string{"filter.fields[0].values", "filter.fields[1].values"},
+		},
+		{
+			name:   "unknown operator",
+			filter: EventFilter{Fields: []FieldFilter{{Path: "{.status.phase}", Operator: "Equals"}}},
+			want:   []string{"filter.fields[0].operator"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			tt.filter.compile("filter", func(field, reason string) {
+				got = append(got, field)
+			})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("compile() errors of fields %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,113 +3,231 @@ package k8sconfigmapcollector
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
 
 	config "github.com/luqmanMohammed/k8s-events-runner/config"
 	"gopkg.in/yaml.v2"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog/v2"
 )
 
 //K8sConfigMapCollector implents ConfigCollector interface and adds functionality
 //to get configs from kuberenets config maps
 type K8sConfigMapCollector struct {
-	k8sClientSet          *kubernetes.Clientset
-	namespace             string
-	runnerConfigLable     string
-	eventMapConfigMapName string
-	runnerTemplates       map[string]*config.RunnerTemplate
-	eventMap              config.EventMap
+	k8sClientSet        *kubernetes.Clientset
+	namespace           string
+	runnerConfigLable   string
+	eventMapConfigLable string
+	runnerInformer      cache.SharedIndexInformer
+	eventMapInformer    cache.SharedIndexInformer
+	reloadMutex         sync.Mutex
+	config.Store
 }
 
 //New instanciates a K8sConfigMapCollector object
-func New(k8sClientSet *kubernetes.Clientset, namespace, runnerConfigLable, eventMapConfigMapName string) *K8sConfigMapCollector {
+func New(k8sClientSet *kubernetes.Clientset, namespace, runnerConfigLable, eventMapConfigLable string) *K8sConfigMapCollector {
 	return &K8sConfigMapCollector{
-		k8sClientSet:          k8sClientSet,
-		namespace:             namespace,
-		runnerConfigLable:     runnerConfigLable,
-		eventMapConfigMapName: eventMapConfigMapName,
-		runnerTemplates:       make(map[string]*config.RunnerTemplate),
+		k8sClientSet:        k8sClientSet,
+		namespace:           namespace,
+		runnerConfigLable:   runnerConfigLable,
+		eventMapConfigLable: eventMapConfigLable,
 	}
 }
 
-//collectRunnerConfigs collects runner templates from config maps in the defined
-//namespace which have the defined label.
+//parseRunnerTemplates parses and validates runner templates from the provided config maps.
 //ConfigMap name is used as a key to store the runner template
-//TODO: Add support for hot loading configs
-func (cmc *K8sConfigMapCollector) collectRunnerTemplates(ctx context.Context) error {
-	runnerCMlist, err := cmc.k8sClientSet.CoreV1().ConfigMaps(cmc.namespace).List(ctx, metav1.ListOptions{
-		LabelSelector: cmc.runnerConfigLable,
-	})
-	if err != nil {
-		klog.Errorf("Error when collecting runner templates %v", err)
-		return err
-	}
-	for _, cm := range runnerCMlist.Items {
+func parseRunnerTemplates(runnerCMs []*v1.ConfigMap) (map[string]*config.RunnerTemplate, config.ValidationErrors) {
+	var errs config.ValidationErrors
+	runnerTemplates := make(map[string]*config.RunnerTemplate)
+	for _, cm := range runnerCMs {
+		if len(cm.Data) != 1 {
+			errs = append(errs, config.ValidationError{
+				ConfigMap: cm.Name,
+				Reason:    fmt.Sprintf("expected exactly one key with the runner template, found %d", len(cm.Data)),
+			})
+			continue
+		}
 		for key, value := range cm.Data {
 			var podTemplate v1.Pod
-			if err = json.Unmarshal([]byte(value), &podTemplate); err != nil {
-				klog.V(1).ErrorS(err, "Failed to collect runner template from %s:%s. Continuing", cm.Name, key)
+			if err := json.Unmarshal([]byte(value), &podTemplate); err != nil {
+				errs = append(errs, config.ValidationError{ConfigMap: cm.Name, Key: key, Reason: fmt.Sprintf("invalid pod template: %v", err)})
 				continue
 			}
 			tmpRunnerTemplate := config.RunnerTemplate(v1.PodTemplateSpec{
 				ObjectMeta: podTemplate.ObjectMeta,
 				Spec:       podTemplate.Spec,
 			})
-			cmc.runnerTemplates[cm.Name] = &tmpRunnerTemplate
+			errs = append(errs, config.ValidateRunnerTemplate(cm.Name, key, &tmpRunnerTemplate)...)
+			runnerTemplates[cm.Name] = &tmpRunnerTemplate
 		}
 		klog.V(2).Infof("Collected templates from ConfigMap: %s", cm.Name)
 	}
-	klog.V(1).Info("Succesffully collected Runner Templates from all ConfigMaps")
+	return runnerTemplates, errs
+}
+
+//parseEventMaps parses and validates the eventMap configs from all keys of the
+//provided config maps against the provided runner templates, and merges them into
+//a single eventMap. Without eventMap ConfigMaps the eventMap is empty, as with the
+//other config collectors.
+func parseEventMaps(eventMapCMs []*v1.ConfigMap, runnerTemplates map[string]*config.RunnerTemplate) (config.EventMap, config.ValidationErrors) {
+	var errs config.ValidationErrors
+	sources := make([]config.EventMapSource, 0, len(eventMapCMs))
+	for _, cm := range eventMapCMs {
+		for key, value := range cm.Data {
+			var eventMapConfig config.EventMap
+			if err := yaml.Unmarshal([]byte(value), &eventMapConfig); err != nil {
+				errs = append(errs, config.ValidationError{ConfigMap: cm.Name, Key: key, Reason: fmt.Sprintf("invalid eventMap config: %v", err)})
+				continue
+			}
+			errs = append(errs, config.ValidateEventMap(cm.Name, key, eventMapConfig, runnerTemplates)...)
+			sources = append(sources, config.EventMapSource{ConfigMap: cm.Name, Key: key, EventMap: eventMapConfig})
+		}
+		klog.V(2).Infof("Collected eventMap from ConfigMap: %s", cm.Name)
+	}
+	eventMap, mergeErrs := config.MergeEventMaps(sources)
+	return eventMap, append(errs, mergeErrs...)
+}
+
+//load parses and validates runner templates and the eventMap from the provided
+//config maps and swaps them in. If any validation errors are found, the current
+//config is kept and the errors are returned.
+func (cmc *K8sConfigMapCollector) load(runnerCMs, eventMapCMs []*v1.ConfigMap) error {
+	sortConfigMaps(runnerCMs)
+	sortConfigMaps(eventMapCMs)
+	runnerTemplates, errs := parseRunnerTemplates(runnerCMs)
+	eventMap, eventMapErrs := parseEventMaps(eventMapCMs, runnerTemplates)
+	if errs = append(errs, eventMapErrs...); len(errs) > 0 {
+		sort.SliceStable(errs, func(i, j int) bool {
+			if errs[i].ConfigMap != errs[j].ConfigMap {
+				return errs[i].ConfigMap < errs[j].ConfigMap
+			}
+			return errs[i].Key < errs[j].Key
+		})
+		return errs
+	}
+	cmc.Swap(runnerTemplates, eventMap)
 	return nil
 }
 
-//collectEventMap collects eventMap config data from a specific confimap selected
-//by using provided configmap name and namespace
-//TODO: Add support for loading eventMap from multi configmaps
-//TODO: Add support for hot-loading configs
-//TODO: Add config validation
-func (cmc *K8sConfigMapCollector) collectEventMap(ctx context.Context) error {
-	eventMapCM, err := cmc.k8sClientSet.CoreV1().ConfigMaps(cmc.namespace).Get(ctx, cmc.eventMapConfigMapName, metav1.GetOptions{})
+//listConfigMaps lists config maps in the defined namespace which match the label selector
+func (cmc *K8sConfigMapCollector) listConfigMaps(ctx context.Context, labelSelector string) ([]*v1.ConfigMap, error) {
+	cmList, err := cmc.k8sClientSet.CoreV1().ConfigMaps(cmc.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labelSelector,
+	})
 	if err != nil {
-		klog.Errorf("Error when collecting eventMap Config %v", err)
-		return err
+		return nil, err
 	}
-	for _, value := range eventMapCM.Data {
-		var eventMapConfig config.EventMap
-		if err = yaml.Unmarshal([]byte(value), &eventMapConfig); err != nil {
-			klog.Errorf("Unable to collect eventMap. Invalid Config: %v", err)
-			return err
-		}
-		cmc.eventMap = eventMapConfig
-		break
+	cms := make([]*v1.ConfigMap, 0, len(cmList.Items))
+	for i := range cmList.Items {
+		cms = append(cms, &cmList.Items[i])
 	}
-	klog.V(1).Infof("Succesffully collected EventMap from ConfigMap: %s", eventMapCM.Name)
-	return nil
+	return cms, nil
 }
 
-//Collect wraps above collector methods to collect both runner and eventMap configs
+//Collect collects runner templates from config maps in the defined namespace which
+//have the runner label, and merges the eventMap configs from all config maps which
+//have the eventMap label. Both configs are validated before being used.
 func (cmc *K8sConfigMapCollector) Collect() error {
-	if err := cmc.collectRunnerTemplates(context.Background()); err != nil {
+	ctx := context.Background()
+	runnerCMs, err := cmc.listConfigMaps(ctx, cmc.runnerConfigLable)
+	if err != nil {
+		klog.Errorf("Error when collecting runner templates %v", err)
+		return err
+	}
+	eventMapCMs, err := cmc.listConfigMaps(ctx, cmc.eventMapConfigLable)
+	if err != nil {
+		klog.Errorf("Error when collecting eventMap Config %v", err)
 		return err
 	}
-	if err := cmc.collectEventMap(context.Background()); err != nil {
+	if err = cmc.load(runnerCMs, eventMapCMs); err != nil {
+		klog.Errorf("Unable to collect configs. Invalid Config: %v", err)
 		return err
 	}
+	klog.V(1).Infof("Succesffully collected Runner Templates from %d ConfigMaps and EventMap from %d ConfigMaps", len(runnerCMs), len(eventMapCMs))
 	return nil
 }
 
-//GetRunnerConfigForResourceAndEvent is a getter which retrieves a runner configuration provided the reosurce and event
-//TODO: Add support for event specific small overides
-func (cmc K8sConfigMapCollector) GetRunnerConfigForResourceAndEvent(resource, event string) (config.RunnerConfig, error) {
-	if runnerSelec, ok := cmc.eventMap[resource][event]; ok {
-		if runnerTemplate, ok := cmc.runnerTemplates[runnerSelec.Runner]; ok {
-			return config.RunnerConfig{
-				RunnerSelector: runnerSelec,
-				RunnerTemplate: runnerTemplate,
-			}, nil
+//storeConfigMaps returns all config maps in the informer store
+func storeConfigMaps(store cache.Store) []*v1.ConfigMap {
+	cms := make([]*v1.ConfigMap, 0)
+	for _, obj := range store.List() {
+		if cm, ok := obj.(*v1.ConfigMap); ok {
+			cms = append(cms, cm)
 		}
 	}
-	return config.RunnerConfig{}, config.ErrRunnerConfigNotFound
+	return cms
+}
+
+//sortConfigMaps sorts config maps by name so configs are loaded deterministically
+func sortConfigMaps(cms []*v1.ConfigMap) {
+	sort.Slice(cms, func(i, j int) bool { return cms[i].Name < cms[j].Name })
+}
+
+//reload rebuilds runner templates and the eventMap from the informer stores and
+//swaps them in. Invalid configs are rejected and the known-good config is kept.
+//Reloads are serialized, as both informers call reload from their own goroutines.
+func (cmc *K8sConfigMapCollector) reload() {
+	cmc.reloadMutex.Lock()
+	defer cmc.reloadMutex.Unlock()
+	if !cmc.runnerInformer.HasSynced() || !cmc.eventMapInformer.HasSynced() {
+		return
+	}
+	runnerCMs := storeConfigMaps(cmc.runnerInformer.GetStore())
+	eventMapCMs := storeConfigMaps(cmc.eventMapInformer.GetStore())
+	if err := cmc.load(runnerCMs, eventMapCMs); err != nil {
+		klog.Errorf("Unable to reload configs, keeping existing config: %v", err)
+		return
+	}
+	klog.V(1).Infof("Reloaded Runner Templates from %d ConfigMaps and EventMap from %d ConfigMaps", len(runnerCMs), len(eventMapCMs))
+}
+
+//newReloadHandler returns an event handler which calls reload on every add, update
+//and delete. Updates which do not change the ConfigMap (informer resyncs) are ignored.
+func newReloadHandler(reload func()) cache.ResourceEventHandlerFuncs {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			reload()
+		},
+		UpdateFunc: func(old, new interface{}) {
+			if old.(*v1.ConfigMap).ResourceVersion == new.(*v1.ConfigMap).ResourceVersion {
+				return
+			}
+			reload()
+		},
+		DeleteFunc: func(obj interface{}) {
+			reload()
+		},
+	}
+}
+
+//Watch starts ConfigMap informers for runner templates and the eventMap, and
+//hot loads configs whenever the watched ConfigMaps are added, updated or deleted.
+//Watch blocks until the informer caches are synced.
+func (cmc *K8sConfigMapCollector) Watch(ctx context.Context) error {
+	runnerInf := informers.NewSharedInformerFactoryWithOptions(cmc.k8sClientSet, 0, informers.WithNamespace(cmc.namespace), informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+		options.LabelSelector = cmc.runnerConfigLable
+	}))
+	eventMapInf := informers.NewSharedInformerFactoryWithOptions(cmc.k8sClientSet, 0, informers.WithNamespace(cmc.namespace), informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+		options.LabelSelector = cmc.eventMapConfigLable
+	}))
+
+	cmc.runnerInformer = runnerInf.Core().V1().ConfigMaps().Informer()
+	cmc.runnerInformer.AddEventHandler(newReloadHandler(cmc.reload))
+	cmc.eventMapInformer = eventMapInf.Core().V1().ConfigMaps().Informer()
+	cmc.eventMapInformer.AddEventHandler(newReloadHandler(cmc.reload))
+
+	runnerInf.Start(ctx.Done())
+	eventMapInf.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), cmc.runnerInformer.HasSynced, cmc.eventMapInformer.HasSynced) {
+		return fmt.Errorf("failed to sync ConfigMap informers")
+	}
+	cmc.reload()
+	klog.V(1).Info("Watching ConfigMaps for runner template and eventMap changes")
+	return nil
 }
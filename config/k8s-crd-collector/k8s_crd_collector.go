@@ -0,0 +1,283 @@
+package k8scrdcollector
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	config "github.com/luqmanMohammed/k8s-events-runner/config"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+const (
+	runnerTemplateKind = "RunnerTemplate"
+	eventRunnerKind    = "EventRunner"
+)
+
+var (
+	//RunnerTemplateGVR identifies the RunnerTemplate custom resource
+	RunnerTemplateGVR = schema.GroupVersionResource{Group: "eventsrunner.io", Version: "v1alpha1", Resource: "runnertemplates"}
+	//EventRunnerGVR identifies the EventRunner custom resource
+	EventRunnerGVR = schema.GroupVersionResource{Group: "eventsrunner.io", Version: "v1alpha1", Resource: "eventrunners"}
+)
+
+//runnerTemplateSpec is the spec of a RunnerTemplate custom resource
+type runnerTemplateSpec struct {
+	Template v1.PodTemplateSpec `json:"template"`
+}
+
+//eventRunnerSpec is the spec of an EventRunner custom resource, which maps events of a
+//resource to a runner
+type eventRunnerSpec struct {
+	Resource              string `json:"resource"`
+	Event                 string `json:"event"`
+	config.RunnerSelector `json:",inline"`
+}
+
+//K8sCRDCollector implents ConfigCollector interface and adds functionality
+//to get configs from RunnerTemplate and EventRunner custom resources
+type K8sCRDCollector struct {
+	dynamicClient          dynamic.Interface
+	namespace              string
+	runnerTemplateInformer cache.SharedIndexInformer
+	eventRunnerInformer    cache.SharedIndexInformer
+	reloadMutex            sync.Mutex
+	config.Store
+}
+
+//New instanciates a K8sCRDCollector object
+func New(dynamicClient dynamic.Interface, namespace string) *K8sCRDCollector {
+	return &K8sCRDCollector{
+		dynamicClient: dynamicClient,
+		namespace:     namespace,
+	}
+}
+
+//specFromUnstructured converts the spec of the custom resource into the provided struct
+func specFromUnstructured(obj *unstructured.Unstructured, spec interface{}) error {
+	specObj, found, err := unstructured.NestedMap(obj.Object, "spec")
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("spec is required")
+	}
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(specObj, spec)
+}
+
+//parseRunnerTemplates parses and validates runner templates from the provided
+//RunnerTemplate custom resources. Resource name is used as a key to store the runner template
+func parseRunnerTemplates(runnerTemplateObjs []*unstructured.Unstructured) (map[string]*config.RunnerTemplate, config.ValidationErrors) {
+	var errs config.ValidationErrors
+	runnerTemplates := make(map[string]*config.RunnerTemplate)
+	for _, obj := range runnerTemplateObjs {
+		var spec runnerTemplateSpec
+		if err := specFromUnstructured(obj, &spec); err != nil {
+			errs = append(errs, config.ValidationError{ConfigMap: obj.GetName(), Key: runnerTemplateKind, Field: "spec", Reason: err.Error()})
+			continue
+		}
+		runnerTemplate := config.RunnerTemplate(spec.Template)
+		errs = append(errs, config.ValidateRunnerTemplate(obj.GetName(), runnerTemplateKind, &runnerTemplate)...)
+		runnerTemplates[obj.GetName()] = &runnerTemplate
+	}
+	return runnerTemplates, errs
+}
+
+//parseEventMap parses and validates EventRunner custom resources against the
+//provided runner templates, and merges them into a single eventMap
+func parseEventMap(eventRunnerObjs []*unstructured.Unstructured, runnerTemplates map[string]*config.RunnerTemplate) (config.EventMap, config.ValidationErrors) {
+	var errs config.ValidationErrors
+	sources := make([]config.EventMapSource, 0, len(eventRunnerObjs))
+	for _, obj := range eventRunnerObjs {
+		var spec eventRunnerSpec
+		if err := specFromUnstructured(obj, &spec); err != nil {
+			errs = append(errs, config.ValidationError{ConfigMap: obj.GetName(), Key: eventRunnerKind, Field: "spec", Reason: err.Error()})
+			continue
+		}
+		eventMap := config.EventMap{
+			spec.Resource: {spec.Event: config.RunnerSelectors{spec.RunnerSelector}},
+		}
+		errs = append(errs, config.ValidateEventMap(obj.GetName(), eventRunnerKind, eventMap, runnerTemplates)...)
+		sources = append(sources, config.EventMapSource{ConfigMap: obj.GetName(), Key: eventRunnerKind, EventMap: eventMap})
+	}
+	eventMap, mergeErrs := config.MergeEventMaps(sources)
+	return eventMap, append(errs, mergeErrs...)
+}
+
+//load parses and validates runner templates and the eventMap from the provided
+//custom resources and swaps them in, then reports on the status of each custom
+//resource whether it was loaded. If any validation errors are found, the current
+//config is kept and the errors are returned.
+func (crdc *K8sCRDCollector) load(ctx context.Context, runnerTemplateObjs, eventRunnerObjs []*unstructured.Unstructured) error {
+	sortObjects(runnerTemplateObjs)
+	sortObjects(eventRunnerObjs)
+	runnerTemplates, errs := parseRunnerTemplates(runnerTemplateObjs)
+	eventMap, eventMapErrs := parseEventMap(eventRunnerObjs, runnerTemplates)
+	errs = append(errs, eventMapErrs...)
+	if len(errs) == 0 {
+		crdc.Swap(runnerTemplates, eventMap)
+	}
+	crdc.updateStatuses(ctx, RunnerTemplateGVR, runnerTemplateKind, runnerTemplateObjs, errs)
+	crdc.updateStatuses(ctx, EventRunnerGVR, eventRunnerKind, eventRunnerObjs, errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+//updateStatuses sets the status subresource of each custom resource to report
+//whether it was loaded, along with its validation errors. Statuses are only
+//updated when they change, to avoid triggering reloads from status updates.
+func (crdc *K8sCRDCollector) updateStatuses(ctx context.Context, gvr schema.GroupVersionResource, kind string, objs []*unstructured.Unstructured, errs config.ValidationErrors) {
+	for _, obj := range objs {
+		var objErrs []string
+		for _, ve := range errs {
+			if ve.ConfigMap == obj.GetName() && ve.Key == kind {
+				objErrs = append(objErrs, fmt.Sprintf("%s: %s", ve.Field, ve.Reason))
+			}
+		}
+		status := map[string]interface{}{
+			"loaded":             len(errs) == 0,
+			"observedGeneration": obj.GetGeneration(),
+		}
+		if len(objErrs) > 0 {
+			status["message"] = strings.Join(objErrs, "; ")
+		} else if len(errs) > 0 {
+			status["message"] = "not loaded due to errors in other resources"
+		}
+		if currentStatus, _, _ := unstructured.NestedMap(obj.Object, "status"); reflect.DeepEqual(currentStatus, status) {
+			continue
+		}
+		updatedObj := obj.DeepCopy()
+		if err := unstructured.SetNestedMap(updatedObj.Object, status, "status"); err != nil {
+			klog.V(2).ErrorS(err, "Failed to set status", "kind", kind, "name", obj.GetName())
+			continue
+		}
+		if _, err := crdc.dynamicClient.Resource(gvr).Namespace(crdc.namespace).UpdateStatus(ctx, updatedObj, metav1.UpdateOptions{}); err != nil {
+			klog.V(2).ErrorS(err, "Failed to update status", "kind", kind, "name", obj.GetName())
+		}
+	}
+}
+
+//sortObjects sorts custom resources by name so configs are loaded deterministically
+func sortObjects(objs []*unstructured.Unstructured) {
+	sort.Slice(objs, func(i, j int) bool { return objs[i].GetName() < objs[j].GetName() })
+}
+
+//listObjects lists custom resources of the provided type in the defined namespace
+func (crdc *K8sCRDCollector) listObjects(ctx context.Context, gvr schema.GroupVersionResource) ([]*unstructured.Unstructured, error) {
+	objList, err := crdc.dynamicClient.Resource(gvr).Namespace(crdc.namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	objs := make([]*unstructured.Unstructured, 0, len(objList.Items))
+	for i := range objList.Items {
+		objs = append(objs, &objList.Items[i])
+	}
+	return objs, nil
+}
+
+//storeObjects returns all custom resources in the informer store
+func storeObjects(store cache.Store) []*unstructured.Unstructured {
+	objs := make([]*unstructured.Unstructured, 0)
+	for _, obj := range store.List() {
+		if u, ok := obj.(*unstructured.Unstructured); ok {
+			objs = append(objs, u)
+		}
+	}
+	return objs
+}
+
+//Collect collects runner templates from RunnerTemplate custom resources and the
+//eventMap from EventRunner custom resources in the defined namespace. Both configs
+//are validated before being used.
+func (crdc *K8sCRDCollector) Collect() error {
+	ctx := context.Background()
+	runnerTemplateObjs, err := crdc.listObjects(ctx, RunnerTemplateGVR)
+	if err != nil {
+		klog.Errorf("Error when collecting runner templates %v", err)
+		return err
+	}
+	eventRunnerObjs, err := crdc.listObjects(ctx, EventRunnerGVR)
+	if err != nil {
+		klog.Errorf("Error when collecting eventMap Config %v", err)
+		return err
+	}
+	if err = crdc.load(ctx, runnerTemplateObjs, eventRunnerObjs); err != nil {
+		klog.Errorf("Unable to collect configs. Invalid Config: %v", err)
+		return err
+	}
+	klog.V(1).Infof("Succesffully collected %d RunnerTemplates and %d EventRunners", len(runnerTemplateObjs), len(eventRunnerObjs))
+	return nil
+}
+
+//reload rebuilds runner templates and the eventMap from the informer stores and
+//swaps them in. Invalid configs are rejected and the known-good config is kept.
+//Reloads are serialized, so that the configs and statuses of an older snapshot of the
+//informer stores never overwrite those of a newer one.
+func (crdc *K8sCRDCollector) reload(ctx context.Context) {
+	crdc.reloadMutex.Lock()
+	defer crdc.reloadMutex.Unlock()
+	if !crdc.runnerTemplateInformer.HasSynced() || !crdc.eventRunnerInformer.HasSynced() {
+		return
+	}
+	runnerTemplateObjs := storeObjects(crdc.runnerTemplateInformer.GetStore())
+	eventRunnerObjs := storeObjects(crdc.eventRunnerInformer.GetStore())
+	if err := crdc.load(ctx, runnerTemplateObjs, eventRunnerObjs); err != nil {
+		klog.Errorf("Unable to reload configs, keeping existing config: %v", err)
+		return
+	}
+	klog.V(1).Infof("Reloaded %d RunnerTemplates and %d EventRunners", len(runnerTemplateObjs), len(eventRunnerObjs))
+}
+
+//newReloadHandler returns an event handler which calls reload on every add, update
+//and delete. Updates which do not change the spec (status updates and informer
+//resyncs) do not change the generation and are ignored.
+func newReloadHandler(reload func()) cache.ResourceEventHandlerFuncs {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			reload()
+		},
+		UpdateFunc: func(old, new interface{}) {
+			if old.(*unstructured.Unstructured).GetGeneration() == new.(*unstructured.Unstructured).GetGeneration() {
+				return
+			}
+			reload()
+		},
+		DeleteFunc: func(obj interface{}) {
+			reload()
+		},
+	}
+}
+
+//Watch starts informers for RunnerTemplate and EventRunner custom resources, and
+//hot loads configs whenever they are added, updated or deleted.
+//Watch blocks until the informer caches are synced.
+func (crdc *K8sCRDCollector) Watch(ctx context.Context) error {
+	inf := dynamicinformer.NewFilteredDynamicSharedInformerFactory(crdc.dynamicClient, 0, crdc.namespace, nil)
+	reload := func() { crdc.reload(ctx) }
+
+	crdc.runnerTemplateInformer = inf.ForResource(RunnerTemplateGVR).Informer()
+	crdc.runnerTemplateInformer.AddEventHandler(newReloadHandler(reload))
+	crdc.eventRunnerInformer = inf.ForResource(EventRunnerGVR).Informer()
+	crdc.eventRunnerInformer.AddEventHandler(newReloadHandler(reload))
+
+	inf.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), crdc.runnerTemplateInformer.HasSynced, crdc.eventRunnerInformer.HasSynced) {
+		return fmt.Errorf("failed to sync custom resource informers")
+	}
+	reload()
+	klog.V(1).Info("Watching RunnerTemplates and EventRunners for changes")
+	return nil
+}
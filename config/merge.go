@@ -0,0 +1,59 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+)
+
+//EventMapSource is an eventMap along with the ConfigMap and key it was collected from
+type EventMapSource struct {
+	ConfigMap string
+	Key       string
+	EventMap  EventMap
+}
+
+//MergeEventMaps merges eventMaps collected from multiple sources into a single EventMap.
+//Sources are merged in ConfigMap then key order, so the result does not depend on
+//the order in which sources were collected. Runners of the same resource:event from
+//different sources are combined. A runner which is defined more than once for the
+//same resource:event is reported as a conflict against the first definition.
+func MergeEventMaps(sources []EventMapSource) (EventMap, ValidationErrors) {
+	sorted := make([]EventMapSource, len(sources))
+	copy(sorted, sources)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].ConfigMap != sorted[j].ConfigMap {
+			return sorted[i].ConfigMap < sorted[j].ConfigMap
+		}
+		return sorted[i].Key < sorted[j].Key
+	})
+
+	var errs ValidationErrors
+	merged := make(EventMap)
+	definedBy := make(map[string]EventMapSource)
+	for _, source := range sorted {
+		for _, resource := range sortedKeys(source.EventMap) {
+			events := source.EventMap[resource]
+			for _, event := range sortedKeys(events) {
+				for i, runnerSelector := range events[event] {
+					field := fmt.Sprintf("%s.%s[%d]", resource, event, i)
+					runnerKey := resource + "." + event + "." + runnerSelector.Runner
+					if first, ok := definedBy[runnerKey]; ok {
+						errs = append(errs, ValidationError{
+							ConfigMap: source.ConfigMap,
+							Key:       source.Key,
+							Field:     field,
+							Reason:    fmt.Sprintf("runner %q conflicts with definition in %s", runnerSelector.Runner, sourceName(first.ConfigMap, first.Key)),
+						})
+						continue
+					}
+					definedBy[runnerKey] = source
+					if _, ok := merged[resource]; !ok {
+						merged[resource] = make(map[string]RunnerSelectors)
+					}
+					merged[resource][event] = append(merged[resource][event], runnerSelector)
+				}
+			}
+		}
+	}
+	return merged, errs
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+//runnerNames returns the runners of the eventMap by resource.event
+func runnerNames(eventMap EventMap) map[string][]string {
+	names := make(map[string][]string)
+	for resource, events := range eventMap {
+		for event, runnerSelectors := range events {
+			for _, runnerSelector := range runnerSelectors {
+				names[resource+"."+event] = append(names[resource+"."+event], runnerSelector.Runner)
+			}
+		}
+	}
+	return names
+}
+
+func TestMergeEventMaps(t *testing.T) {
+	selectors := func(runners ...string) RunnerSelectors {
+		runnerSelectors := make(RunnerSelectors, 0)
+		for _, runner := range runners {
+			runnerSelectors = append(runnerSelectors, RunnerSelector{Runner: runner})
+		}
+		return runnerSelectors
+	}
+	tests := []struct {
+		name     string
+		sources  []EventMapSource
+		want     map[string][]string
+		wantErrs ValidationErrors
+	}{
+		{
+			name:    "no sources",
+			sources: nil,
+			want:    map[string][]string{},
+		},
+		{
+			name: "different resources and events",
+			sources: []EventMapSource{
+				{ConfigMap: "a", Key: "eventMap", EventMap: EventMap{"pods": {"ADDED": selectors("r1")}}},
+				{ConfigMap: "b", Key: "eventMap", EventMap: EventMap{"pods": {"DELETED": selectors("r2")}, "deployments": {"*": selectors("r3")}}},
+			},
+			want: map[string][]string{"pods.ADDED": {"r1"}, "pods.DELETED": {"r2"}, "deployments.*": {"r3"}},
+		},
+		{
+			name: "runners of the same resource:event are combined in source order",
+			sources: []EventMapSource{
+				{ConfigMap: "b", Key: "eventMap", EventMap: EventMap{"pods": {"ADDED": selectors("r2")}}},
+				{ConfigMap: "a", Key: "second", EventMap: EventMap{"pods": {"ADDED": selectors("r3")}}},
+				{ConfigMap: "a", Key: "first", EventMap: EventMap{"pods": {"ADDED": selectors("r1")}}},
+			},
+			want: map[string][]string{"pods.ADDED": {"r1", "r3", "r2"}},
+		},
+		{
+			name: "conflict is reported against the first source",
+			sources: []EventMapSource{
+				{ConfigMap: "b", Key: "eventMap", EventMap: EventMap{"pods": {"ADDED": selectors("r2", "r1")}}},
+				{ConfigMap: "a", Key: "eventMap", EventMap: EventMap{"pods": {"ADDED": selectors("r1")}}},
+			},
+			want: map[string][]string{"pods.ADDED": {"r1", "r2"}},
+			wantErrs: ValidationErrors{{
+				ConfigMap: "b",
+				Key:       "eventMap",
+				Field:     "pods.ADDED[1]",
+				Reason:    `runner "r1" conflicts with definition in a:eventMap`,
+			}},
+		},
+		{
+			name: "duplicate runner within a source",
+			sources: []EventMapSource{
+				{ConfigMap: "a", Key: "eventMap", EventMap: EventMap{"pods": {"ADDED": selectors("r1", "r1")}}},
+			},
+			want: map[string][]string{"pods.ADDED": {"r1"}},
+			wantErrs: ValidationErrors{{
+				ConfigMap: "a",
+				Key:       "eventMap",
+				Field:     "pods.ADDED[1]",
+				Reason:    `runner "r1" conflicts with definition in a:eventMap`,
+			}},
+		},
+		{
+			name: "same runner for other resources or events does not conflict",
+			sources: []EventMapSource{
+				{ConfigMap: "a", Key: "eventMap", EventMap: EventMap{"pods": {"ADDED": selectors("r1")}}},
+				{ConfigMap: "b", Key: "eventMap", EventMap: EventMap{"pods": {"*": selectors("r1")}, "*": {"ADDED": selectors("r1")}}},
+			},
+			want: map[string][]string{"pods.ADDED": {"r1"}, "pods.*": {"r1"}, "*.ADDED": {"r1"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, errs := MergeEventMaps(tt.sources)
+			if got := runnerNames(merged); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MergeEventMaps() runners = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(errs, tt.wantErrs) {
+				t.Errorf("MergeEventMaps() errors = %v, want %v", errs, tt.wantErrs)
+			}
+		})
+	}
+}
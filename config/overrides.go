@@ -0,0 +1,150 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+//RunnerOverrides contains event specific overrides which are merged onto the
+//shared runner template. Overrides are applied to every container of the template.
+type RunnerOverrides struct {
+	Env                []EnvVarOverride   `yaml:"env" json:"env,omitempty"`
+	Args               []string           `yaml:"args" json:"args,omitempty"`
+	Resources          ResourcesOverrides `yaml:"resources" json:"resources,omitempty"`
+	ServiceAccountName string             `yaml:"serviceAccountName" json:"serviceAccountName,omitempty"`
+	NodeSelector       map[string]string  `yaml:"nodeSelector" json:"nodeSelector,omitempty"`
+	ImageTag           string             `yaml:"imageTag" json:"imageTag,omitempty"`
+}
+
+//EnvVarOverride is an env var which is added to or replaces the env var with the
+//same name in each container
+type EnvVarOverride struct {
+	Name  string `yaml:"name" json:"name,omitempty"`
+	Value string `yaml:"value" json:"value,omitempty"`
+}
+
+//ResourcesOverrides contains resource requests and limits which are added to or
+//replace the requests and limits of the same resource in each container
+type ResourcesOverrides struct {
+	Requests map[string]string `yaml:"requests" json:"requests,omitempty"`
+	Limits   map[string]string `yaml:"limits" json:"limits,omitempty"`
+}
+
+//NewRunnerConfig creates a RunnerConfig with a copy of the runner template which
+//has the selector's overrides merged onto it. The shared runner template is never modified.
+func NewRunnerConfig(runnerSelector RunnerSelector, runnerTemplate *RunnerTemplate) RunnerConfig {
+	podTemplate := (*v1.PodTemplateSpec)(runnerTemplate).DeepCopy()
+	if runnerSelector.Overrides != nil {
+		runnerSelector.Overrides.apply(podTemplate)
+	}
+	mergedTemplate := RunnerTemplate(*podTemplate)
+	return RunnerConfig{
+		RunnerSelector: runnerSelector,
+		RunnerTemplate: &mergedTemplate,
+	}
+}
+
+//apply strategically merges the overrides onto the pod template. Env vars, resources
+//and node selectors are merged by key, args are appended, and the service account
+//and image tag are replaced.
+func (ro *RunnerOverrides) apply(podTemplate *v1.PodTemplateSpec) {
+	if ro.ServiceAccountName != "" {
+		podTemplate.Spec.ServiceAccountName = ro.ServiceAccountName
+	}
+	if len(ro.NodeSelector) > 0 {
+		if podTemplate.Spec.NodeSelector == nil {
+			podTemplate.Spec.NodeSelector = make(map[string]string)
+		}
+		for k, v := range ro.NodeSelector {
+			podTemplate.Spec.NodeSelector[k] = v
+		}
+	}
+	for i := range podTemplate.Spec.Containers {
+		container := &podTemplate.Spec.Containers[i]
+		for _, envOverride := range ro.Env {
+			container.Env = mergeEnvVar(container.Env, v1.EnvVar{Name: envOverride.Name, Value: envOverride.Value})
+		}
+		container.Args = append(container.Args, ro.Args...)
+		container.Resources.Requests = mergeResourceList(container.Resources.Requests, ro.Resources.Requests)
+		container.Resources.Limits = mergeResourceList(container.Resources.Limits, ro.Resources.Limits)
+		if ro.ImageTag != "" {
+			container.Image = replaceImageTag(container.Image, ro.ImageTag)
+		}
+	}
+}
+
+//mergeEnvVar replaces the env var with the same name or appends it
+func mergeEnvVar(envVars []v1.EnvVar, envVar v1.EnvVar) []v1.EnvVar {
+	for i := range envVars {
+		if envVars[i].Name == envVar.Name {
+			envVars[i] = envVar
+			return envVars
+		}
+	}
+	return append(envVars, envVar)
+}
+
+//mergeResourceList merges the overrides onto the resource list. Quantities are
+//validated when the eventMap is collected, so invalid quantities are skipped.
+func mergeResourceList(resourceList v1.ResourceList, overrides map[string]string) v1.ResourceList {
+	if len(overrides) == 0 {
+		return resourceList
+	}
+	if resourceList == nil {
+		resourceList = make(v1.ResourceList)
+	}
+	for name, value := range overrides {
+		if quantity, err := resource.ParseQuantity(value); err == nil {
+			resourceList[v1.ResourceName(name)] = quantity
+		}
+	}
+	return resourceList
+}
+
+//replaceImageTag replaces the tag or digest of the image with the provided tag
+func replaceImageTag(image, tag string) string {
+	if i := strings.Index(image, "@"); i != -1 {
+		image = image[:i]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	return image + ":" + tag
+}
+
+//validate checks that the overrides can be merged onto a runner template
+func (ro *RunnerOverrides) validate(field string, addErr func(field, reason string)) {
+	for i, envOverride := range ro.Env {
+		if envOverride.Name == "" {
+			addErr(fmt.Sprintf("%s.env[%d].name", field, i), "env var name is required")
+		}
+		if isTemplate(envOverride.Value) {
+			if _, err := parseTemplate(field, envOverride.Value); err != nil {
+				addErr(fmt.Sprintf("%s.env[%d].value", field, i), fmt.Sprintf("invalid template: %v", err))
+			}
+		}
+	}
+	for i, arg := range ro.Args {
+		if isTemplate(arg) {
+			if _, err := parseTemplate(field, arg); err != nil {
+				addErr(fmt.Sprintf("%s.args[%d]", field, i), fmt.Sprintf("invalid template: %v", err))
+			}
+		}
+	}
+	for _, name := range sortedKeys(ro.Resources.Requests) {
+		if _, err := resource.ParseQuantity(ro.Resources.Requests[name]); err != nil {
+			addErr(field+".resources.requests."+name, err.Error())
+		}
+	}
+	for _, name := range sortedKeys(ro.Resources.Limits) {
+		if _, err := resource.ParseQuantity(ro.Resources.Limits[name]); err != nil {
+			addErr(field+".resources.limits."+name, err.Error())
+		}
+	}
+	if strings.ContainsAny(ro.ImageTag, ":@/") {
+		addErr(field+".imageTag", "must be a bare tag without repository or digest")
+	}
+}
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestNewRunnerConfigOverrides(t *testing.T) {
+	newTemplate := func() *RunnerTemplate {
+		return &RunnerTemplate{
+			Spec: v1.PodSpec{
+				ServiceAccountName: "runner",
+				NodeSelector:       map[string]string{"pool": "default"},
+				Containers: []v1.Container{
+					{
+						Name:  "main",
+						Image: "registry:5000/runner:v1",
+						Args:  []string{"run"},
+						Env:   []v1.EnvVar{{Name: "LEVEL", Value: "info"}, {Name: "MODE", Value: "fast"}},
+						Resources: v1.ResourceRequirements{
+							Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("100m"), v1.ResourceMemory: resource.MustParse("64Mi")},
+						},
+					},
+					{Name: "sidecar", Image: "sidecar@sha256:abc"},
+				},
+			},
+		}
+	}
+	tests := []struct {
+		name      string
+		overrides *RunnerOverrides
+		want      func(spec *v1.PodSpec)
+	}{
+		{
+			name: "no overrides",
+			want: func(spec *v1.PodSpec) {},
+		},
+		{
+			name:      "env vars are replaced by name or appended",
+			overrides: &RunnerOverrides{Env: []EnvVarOverride{{Name: "LEVEL", Value: "debug"}, {Name: "EXTRA", Value: "1"}}},
+			want: func(spec *v1.PodSpec) {
+				spec.Containers[0].Env = []v1.EnvVar{{Name: "LEVEL", Value: "debug"}, {Name: "MODE", Value: "fast"}, {Name: "EXTRA", Value: "1"}}
+				spec.Containers[1].Env = []v1.EnvVar{{Name: "LEVEL", Value: "debug"}, {Name: "EXTRA", Value: "1"}}
+			},
+		},
+		{
+			name:      "args are appended",
+			overrides: &RunnerOverrides{Args: []string{"--verbose"}},
+			want: func(spec *v1.PodSpec) {
+				spec.Containers[0].Args = []string{"run", "--verbose"}
+				spec.Containers[1].Args = []string{"--verbose"}
+			},
+		},
+		{
+			name: "resources are merged by name",
+			overrides: &RunnerOverrides{Resources: ResourcesOverrides{
+				Requests: map[string]string{"cpu": "500m"},
+				Limits:   map[string]string{"memory": "1Gi"},
+			}},
+			want: func(spec *v1.PodSpec) {
+				spec.Containers[0].Resources.Requests[v1.ResourceCPU] = resource.MustParse("500m")
+				spec.Containers[0].Resources.Limits = v1.ResourceList{v1.ResourceMemory: resource.MustParse("1Gi")}
+				spec.Containers[1].Resources = v1.ResourceRequirements{
+					Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("500m")},
+					Limits:   v1.ResourceList{v1.ResourceMemory: resource.MustParse("1Gi")},
+				}
+			},
+		},
+		{
+			name:      "service account is replaced and node selector merged",
+			overrides: &RunnerOverrides{ServiceAccountName: "admin", NodeSelector: map[string]string{"pool": "gpu", "zone": "a"}},
+			want: func(spec *v1.PodSpec) {
+				spec.ServiceAccountName = "admin"
+				spec.NodeSelector = map[string]string{"pool": "gpu", "zone": "a"}
+			},
+		},
+		{
+			name:      "image tag replaces tags and digests",
+			overrides: &RunnerOverrides{ImageTag: "v2"},
+			want: func(spec *v1.PodSpec) {
+				spec.Containers[0].Image = "registry:5000/runner:v2"
+				spec.Containers[1].Image = "sidecar:v2"
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runnerTemplate := newTemplate()
+			runnerConfig := NewRunnerConfig(RunnerSelector{Runner: "runner", Overrides: tt.overrides}, runnerTemplate)
+			want := newTemplate()
+			tt.want(&want.Spec)
+			if !reflect.DeepEqual(runnerConfig.RunnerTemplate.Spec, want.Spec) {
+				t.Errorf("NewRunnerConfig() spec = %+v, want %+v", runnerConfig.RunnerTemplate.Spec, want.Spec)
+			}
+			if !reflect.DeepEqual(runnerTemplate, newTemplate()) {
+				t.Errorf("NewRunnerConfig() modified the shared runner template")
+			}
+		})
+	}
+}
+
+func TestReplaceImageTag(t *testing.T) {
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{image: "runner", want: "runner:v2"},
+		{image: "runner:v1", want: "runner:v2"},
+		{image: "registry:5000/runner", want: "registry:5000/runner:v2"},
+		{image: "registry:5000/team/runner:v1", want: "registry:5000/team/runner:v2"},
+		{image: "runner@sha256:abc", want: "runner:v2"},
+		{image: "runner:v1@sha256:abc", want: "runner:v2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			if got := replaceImageTag(tt.image, "v2"); got != tt.want {
+				t.Errorf("replaceImageTag(%q) = %q, want %q", tt.image, got, tt.want)
+			}
+		})
+	}
+}
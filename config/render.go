@@ -0,0 +1,103 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+//templateField is a runner template field which is rendered as a go template
+type templateField struct {
+	field string
+	value string
+	set   func(string)
+}
+
+//isTemplate reports whether the value contains go template actions
+func isTemplate(value string) bool {
+	return strings.Contains(value, "{{")
+}
+
+//parseTemplate parses the value as a go template. Missing keys are treated as errors
+//so that events without the expected fields do not silently produce empty values.
+func parseTemplate(name, value string) (*template.Template, error) {
+	return template.New(name).Option("missingkey=error").Parse(value)
+}
+
+//templateFields returns the runner template fields which are rendered as go templates:
+//container args, env values, labels and annotations
+func templateFields(podTemplate *v1.PodTemplateSpec) []templateField {
+	var fields []templateField
+	addMapFields := func(mapField string, m map[string]string) {
+		for _, key := range sortedKeys(m) {
+			key := key
+			fields = append(fields, templateField{field: mapField + "." + key, value: m[key], set: func(rendered string) { m[key] = rendered }})
+		}
+	}
+	addStringField := func(field string, value *string) {
+		fields = append(fields, templateField{field: field, value: *value, set: func(rendered string) { *value = rendered }})
+	}
+	addMapFields("metadata.labels", podTemplate.Labels)
+	addMapFields("metadata.annotations", podTemplate.Annotations)
+	addContainerFields := func(containersField string, containers []v1.Container) {
+		for i := range containers {
+			for j := range containers[i].Args {
+				addStringField(fmt.Sprintf("%s[%d].args[%d]", containersField, i, j), &containers[i].Args[j])
+			}
+			for j := range containers[i].Env {
+				addStringField(fmt.Sprintf("%s[%d].env[%d].value", containersField, i, j), &containers[i].Env[j].Value)
+			}
+		}
+	}
+	addContainerFields("spec.initContainers", podTemplate.Spec.InitContainers)
+	addContainerFields("spec.containers", podTemplate.Spec.Containers)
+	return fields
+}
+
+//validateTemplates checks that all templated runner template fields can be parsed
+func validateTemplates(podTemplate *v1.PodTemplateSpec, addErr func(field, reason string)) {
+	for _, tf := range templateFields(podTemplate) {
+		if !isTemplate(tf.value) {
+			continue
+		}
+		if _, err := parseTemplate(tf.field, tf.value); err != nil {
+			addErr(tf.field, fmt.Sprintf("invalid template: %v", err))
+		}
+	}
+}
+
+//renderValue renders a single templated value with the event as data
+func renderValue(field, value string, event Event) (string, error) {
+	if !isTemplate(value) {
+		return value, nil
+	}
+	tmpl, err := parseTemplate(field, value)
+	if err != nil {
+		return "", err
+	}
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, event); err != nil {
+		return "", err
+	}
+	return rendered.String(), nil
+}
+
+//Render returns a copy of the RunnerConfig with container args, env values, labels and
+//annotations of the runner template rendered as go templates using the event as data,
+//e.g. {{ .Object.metadata.name }}
+func (rc RunnerConfig) Render(event Event) (RunnerConfig, error) {
+	podTemplate := (*v1.PodTemplateSpec)(rc.RunnerTemplate).DeepCopy()
+	for _, tf := range templateFields(podTemplate) {
+		rendered, err := renderValue(tf.field, tf.value, event)
+		if err != nil {
+			return RunnerConfig{}, fmt.Errorf("failed to render %s: %v", tf.field, err)
+		}
+		tf.set(rendered)
+	}
+	renderedTemplate := RunnerTemplate(*podTemplate)
+	rc.RunnerTemplate = &renderedTemplate
+	return rc, nil
+}
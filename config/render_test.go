@@ -0,0 +1,81 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRunnerConfigRender(t *testing.T) {
+	event := Event{
+		EventType: "ADDED",
+		Resource:  "pods",
+		Object: map[string]interface{}{
+			"metadata": map[string]interface{}{"name": "web-0", "namespace": "default"},
+		},
+	}
+	newTemplate := func(labels map[string]string, args []string, env []v1.EnvVar) *RunnerTemplate {
+		return &RunnerTemplate{
+			ObjectMeta: metav1.ObjectMeta{Labels: labels},
+			Spec: v1.PodSpec{
+				InitContainers: []v1.Container{{Name: "init", Args: args}},
+				Containers:     []v1.Container{{Name: "main", Args: args, Env: env}},
+			},
+		}
+	}
+	tests := []struct {
+		name     string
+		template *RunnerTemplate
+		want     *RunnerTemplate
+		wantErr  string
+	}{
+		{
+			name:     "values without templates are kept",
+			template: newTemplate(map[string]string{"app": "runner"}, []string{"run", "{ .x }"}, []v1.EnvVar{{Name: "LEVEL", Value: "info"}}),
+			want:     newTemplate(map[string]string{"app": "runner"}, []string{"run", "{ .x }"}, []v1.EnvVar{{Name: "LEVEL", Value: "info"}}),
+		},
+		{
+			name: "labels, args and env values are rendered with the event",
+			template: newTemplate(
+				map[string]string{"event": "{{ .EventType }}"},
+				[]string{"{{ .Object.metadata.namespace }}/{{ .Object.metadata.name }}"},
+				[]v1.EnvVar{{Name: "RESOURCE", Value: "{{ .Resource }}"}},
+			),
+			want: newTemplate(
+				map[string]string{"event": "ADDED"},
+				[]string{"default/web-0"},
+				[]v1.EnvVar{{Name: "RESOURCE", Value: "pods"}},
+			),
+		},
+		{
+			name:     "missing keys are errors",
+			template: newTemplate(nil, []string{"{{ .Object.spec.nodeName }}"}, nil),
+			wantErr:  "failed to render spec.initContainers[0].args[0]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runnerConfig := RunnerConfig{RunnerTemplate: tt.template}
+			original := (*v1.PodTemplateSpec)(tt.template).DeepCopy()
+			rendered, err := runnerConfig.Render(event)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Render() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+			if !reflect.DeepEqual(rendered.RunnerTemplate, tt.want) {
+				t.Errorf("Render() template = %+v, want %+v", rendered.RunnerTemplate, tt.want)
+			}
+			if !reflect.DeepEqual((*v1.PodTemplateSpec)(tt.template), original) {
+				t.Errorf("Render() modified the runner template")
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+//Wildcard matches any resource or event type in the eventMap
+const Wildcard = "*"
+
+//ParseResourceKey parses an eventMap resource key. Keys are either a wildcard, a
+//resource name such as deployments, or a GroupVersionResource qualified name such as
+//apps/v1/deployments or v1/pods for the core group.
+func ParseResourceKey(key string) (schema.GroupVersionResource, error) {
+	if key == Wildcard {
+		return schema.GroupVersionResource{Resource: Wildcard}, nil
+	}
+	parts := strings.Split(key, "/")
+	for _, part := range parts {
+		if part == "" || strings.Contains(part, Wildcard) {
+			return schema.GroupVersionResource{}, fmt.Errorf("invalid resource %q, expected *, resource, version/resource or group/version/resource", key)
+		}
+	}
+	switch len(parts) {
+	case 1:
+		return schema.GroupVersionResource{Resource: parts[0]}, nil
+	case 2:
+		return schema.GroupVersionResource{Version: parts[0], Resource: parts[1]}, nil
+	case 3:
+		return schema.GroupVersionResource{Group: parts[0], Version: parts[1], Resource: parts[2]}, nil
+	}
+	return schema.GroupVersionResource{}, fmt.Errorf("invalid resource %q, expected *, resource, version/resource or group/version/resource", key)
+}
+
+//ResourceKey formats the GroupVersionResource as an eventMap resource key. If the
+//version is unknown, only the resource name is used.
+func ResourceKey(gvr schema.GroupVersionResource) string {
+	switch {
+	case gvr.Version == "":
+		return gvr.Resource
+	case gvr.Group == "":
+		return gvr.Version + "/" + gvr.Resource
+	}
+	return gvr.Group + "/" + gvr.Version + "/" + gvr.Resource
+}
+
+//GroupVersionResource returns the GroupVersionResource of the event. The resource
+//type of the event can be qualified, otherwise the group and version are taken from
+//the apiVersion of the event object.
+func (e Event) GroupVersionResource() schema.GroupVersionResource {
+	gvr, err := ParseResourceKey(e.Resource)
+	if err != nil || gvr.Version != "" {
+		return gvr
+	}
+	if apiVersion, ok := e.Object["apiVersion"].(string); ok {
+		if gv, err := schema.ParseGroupVersion(apiVersion); err == nil {
+			gvr.Group, gvr.Version = gv.Group, gv.Version
+		}
+	}
+	return gvr
+}
+
+//resourceLookupKeys returns the eventMap resource keys which match the event, in
+//order of precedence: GroupVersionResource qualified name, resource name, wildcard
+func (e Event) resourceLookupKeys() []string {
+	gvr := e.GroupVersionResource()
+	keys := make([]string, 0, 3)
+	if gvr.Version != "" {
+		keys = append(keys, ResourceKey(gvr))
+	}
+	if gvr.Resource != "" && gvr.Resource != Wildcard {
+		keys = append(keys, gvr.Resource)
+	}
+	return append(keys, Wildcard)
+}
+
+//eventLookupKeys returns the eventMap event keys which match the event, in order of
+//precedence: event type, wildcard
+func (e Event) eventLookupKeys() []string {
+	if e.EventType == "" || e.EventType == Wildcard {
+		return []string{Wildcard}
+	}
+	return []string{e.EventType, Wildcard}
+}
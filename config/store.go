@@ -0,0 +1,61 @@
+package config
+
+import "sync"
+
+//Store holds the collected runner templates and eventMap. Configs are swapped in
+//atomically, so lookups are safe while configs are being hot loaded.
+//Store is meant to be embedded in ConfigCollector implementations.
+type Store struct {
+	mutex           sync.RWMutex
+	runnerTemplates map[string]*RunnerTemplate
+	eventMap        EventMap
+}
+
+//Swap replaces the stored runner templates and eventMap. Configs must be validated
+//before they are swapped in.
+func (s *Store) Swap(runnerTemplates map[string]*RunnerTemplate, eventMap EventMap) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.runnerTemplates = runnerTemplates
+	s.eventMap = eventMap
+}
+
+//GetRunnerConfigsForEvent is a getter which retrieves the configurations of all runners triggered by the
+//event's reosurce and event type, whose filters match the event. Event specific overrides are merged onto
+//a copy of each runner template. If runners are configured but none match their filters, an empty list is returned.
+func (s *Store) GetRunnerConfigsForEvent(event Event) ([]RunnerConfig, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	runnerSelecs, ok := s.lookup(event)
+	if !ok {
+		return nil, ErrRunnerConfigNotFound
+	}
+	runnerConfigs := make([]RunnerConfig, 0, len(runnerSelecs))
+	for _, runnerSelec := range runnerSelecs {
+		if runnerSelec.Filter != nil && !runnerSelec.Filter.Matches(event) {
+			continue
+		}
+		if runnerTemplate, ok := s.runnerTemplates[runnerSelec.Runner]; ok {
+			runnerConfigs = append(runnerConfigs, NewRunnerConfig(runnerSelec, runnerTemplate))
+		}
+	}
+	return runnerConfigs, nil
+}
+
+//lookup finds the runners of the most specific eventMap entry matching the event.
+//Resource keys take precedence over event keys, and within each, exact keys beat
+//wildcards, e.g. apps/v1/deployments:* beats deployments:ADDED which beats *:ADDED.
+func (s *Store) lookup(event Event) (RunnerSelectors, bool) {
+	for _, resourceKey := range event.resourceLookupKeys() {
+		events, ok := s.eventMap[resourceKey]
+		if !ok {
+			continue
+		}
+		for _, eventKey := range event.eventLookupKeys() {
+			if runnerSelecs, ok := events[eventKey]; ok {
+				return runnerSelecs, true
+			}
+		}
+	}
+	return nil, false
+}
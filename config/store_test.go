@@ -0,0 +1,118 @@
+package config
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStoreLookupPrecedence(t *testing.T) {
+	selector := func(runner string) RunnerSelectors {
+		return RunnerSelectors{{Runner: runner}}
+	}
+	eventMap := EventMap{
+		"apps/v1/deployments": {"*": selector("gvr-any")},
+		"deployments":         {"ADDED": selector("name-added"), "*": selector("name-any")},
+		"v1/pods":             {"DELETED": selector("core-gvr-deleted")},
+		"pods":                {"ADDED": selector("name-pods-added")},
+		"*":                   {"ADDED": selector("wildcard-added"), "*": selector("wildcard-any")},
+	}
+	runnerTemplates := make(map[string]*RunnerTemplate)
+	for _, events := range eventMap {
+		for _, runnerSelectors := range events {
+			runnerTemplates[runnerSelectors[0].Runner] = &RunnerTemplate{}
+		}
+	}
+	object := func(apiVersion string) map[string]interface{} {
+		return map[string]interface{}{"apiVersion": apiVersion}
+	}
+	tests := []struct {
+		name  string
+		event Event
+		want  string
+	}{
+		{
+			name:  "group version resource key beats exact event of resource name",
+			event: Event{EventType: "ADDED", Resource: "deployments", Object: object("apps/v1")},
+			want:  "gvr-any",
+		},
+		{
+			name:  "qualified resource type of the event",
+			event: Event{EventType: "ADDED", Resource: "apps/v1/deployments"},
+			want:  "gvr-any",
+		},
+		{
+			name:  "resource name when the version does not match",
+			event: Event{EventType: "ADDED", Resource: "deployments", Object: object("apps/v1beta1")},
+			want:  "name-added",
+		},
+		{
+			name:  "exact event beats event wildcard",
+			event: Event{EventType: "ADDED", Resource: "deployments"},
+			want:  "name-added",
+		},
+		{
+			name:  "event wildcard of the resource name",
+			event: Event{EventType: "MODIFIED", Resource: "deployments"},
+			want:  "name-any",
+		},
+		{
+			name:  "core group key",
+			event: Event{EventType: "DELETED", Resource: "pods", Object: object("v1")},
+			want:  "core-gvr-deleted",
+		},
+		{
+			name:  "falls through to the resource name when the qualified key has no matching event",
+			event: Event{EventType: "ADDED", Resource: "pods", Object: object("v1")},
+			want:  "name-pods-added",
+		},
+		{
+			name:  "resource key beats exact event of the resource wildcard",
+			event: Event{EventType: "MODIFIED", Resource: "pods", Object: object("v1")},
+			want:  "wildcard-any",
+		},
+		{
+			name:  "resource wildcard with exact event",
+			event: Event{EventType: "ADDED", Resource: "services"},
+			want:  "wildcard-added",
+		},
+		{
+			name:  "resource and event wildcard",
+			event: Event{EventType: "DELETED", Resource: "services"},
+			want:  "wildcard-any",
+		},
+	}
+	var store Store
+	store.Swap(runnerTemplates, eventMap)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runnerConfigs, err := store.GetRunnerConfigsForEvent(tt.event)
+			if err != nil {
+				t.Fatalf("GetRunnerConfigsForEvent() error = %v", err)
+			}
+			if len(runnerConfigs) != 1 || runnerConfigs[0].Runner != tt.want {
+				t.Errorf("GetRunnerConfigsForEvent() = %v, want runner %s", runnerConfigs, tt.want)
+			}
+		})
+	}
+}
+
+func TestStoreLookupNotFound(t *testing.T) {
+	var store Store
+	store.Swap(map[string]*RunnerTemplate{"runner": {}}, EventMap{
+		"deployments": {"ADDED": RunnerSelectors{{Runner: "runner"}}},
+	})
+	tests := []struct {
+		name  string
+		event Event
+	}{
+		{name: "other event", event: Event{EventType: "DELETED", Resource: "deployments"}},
+		{name: "other resource", event: Event{EventType: "ADDED", Resource: "pods"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := store.GetRunnerConfigsForEvent(tt.event); !errors.Is(err, ErrRunnerConfigNotFound) {
+				t.Errorf("GetRunnerConfigsForEvent() error = %v, want %v", err, ErrRunnerConfigNotFound)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+//ValidationError describes a single problem found in a collected config
+type ValidationError struct {
+	ConfigMap string `json:"configMap"`
+	Key       string `json:"key"`
+	Field     string `json:"field"`
+	Reason    string `json:"reason"`
+}
+
+func (ve ValidationError) Error() string {
+	parts := []string{sourceName(ve.ConfigMap, ve.Key)}
+	if ve.Field != "" {
+		parts = append(parts, ve.Field)
+	}
+	return strings.Join(append(parts, ve.Reason), ": ")
+}
+
+//sourceName returns a printable name for the ConfigMap and key a config was collected
+//from. Key is omitted for collectors which do not use keys.
+func sourceName(configMap, key string) string {
+	if key == "" {
+		return configMap
+	}
+	return configMap + ":" + key
+}
+
+//ValidationErrors is a list of problems found in a collected config.
+//A config with one or more ValidationErrors must not be used.
+type ValidationErrors []ValidationError
+
+func (ves ValidationErrors) Error() string {
+	errStrs := make([]string, 0, len(ves))
+	for _, ve := range ves {
+		errStrs = append(errStrs, ve.Error())
+	}
+	return fmt.Sprintf("%d config validation error(s): %s", len(ves), strings.Join(errStrs, "; "))
+}
+
+//ValidateRunnerTemplate checks that the runner template can be used to create a pod
+func ValidateRunnerTemplate(configMap, key string, runnerTemplate *RunnerTemplate) ValidationErrors {
+	var errs ValidationErrors
+	addErr := func(field, reason string) {
+		errs = append(errs, ValidationError{ConfigMap: configMap, Key: key, Field: field, Reason: reason})
+	}
+	if runnerTemplate == nil {
+		addErr("", "runner template is empty")
+		return errs
+	}
+	if len(runnerTemplate.Spec.Containers) == 0 {
+		addErr("spec.containers", "at least one container is required")
+	}
+	for i, container := range runnerTemplate.Spec.Containers {
+		if container.Name == "" {
+			addErr(fmt.Sprintf("spec.containers[%d].name", i), "container name is required")
+		}
+		if container.Image == "" {
+			addErr(fmt.Sprintf("spec.containers[%d].image", i), "container image is required")
+		}
+	}
+	validateTemplates((*v1.PodTemplateSpec)(runnerTemplate), addErr)
+	return errs
+}
+
+//ValidateEventMap checks that every RunnerSelector in the eventMap names a collected
+//runner template and has sane limits. Event filters are compiled while being validated.
+func ValidateEventMap(configMap, key string, eventMap EventMap, runnerTemplates map[string]*RunnerTemplate) ValidationErrors {
+	var errs ValidationErrors
+	addErr := func(field, reason string) {
+		errs = append(errs, ValidationError{ConfigMap: configMap, Key: key, Field: field, Reason: reason})
+	}
+	for _, resource := range sortedKeys(eventMap) {
+		events := eventMap[resource]
+		if _, err := ParseResourceKey(resource); err != nil {
+			addErr(resource, err.Error())
+		}
+		for _, event := range sortedKeys(events) {
+			if event == "" {
+				addErr(resource+"."+event, "event must not be empty")
+			}
+			if len(events[event]) == 0 {
+				addErr(resource+"."+event, "at least one runner is required")
+			}
+			for i, runnerSelector := range events[event] {
+				validateRunnerSelector(fmt.Sprintf("%s.%s[%d]", resource, event, i), runnerSelector, runnerTemplates, addErr)
+			}
+		}
+	}
+	return errs
+}
+
+//validateRunnerSelector checks that the RunnerSelector names a collected runner
+//template and has sane limits
+func validateRunnerSelector(field string, runnerSelector RunnerSelector, runnerTemplates map[string]*RunnerTemplate, addErr func(field, reason string)) {
+	if runnerSelector.Runner == "" {
+		addErr(field+".runner", "runner is required")
+	} else if _, ok := runnerTemplates[runnerSelector.Runner]; !ok {
+		addErr(field+".runner", fmt.Sprintf("runner template %q not found", runnerSelector.Runner))
+	}
+	if runnerSelector.ConcurrencyLimit < -1 {
+		addErr(field+".concurrencyLimit", "must be -1 (unlimited) or greater")
+	}
+	if runnerSelector.RetryLimit < 0 {
+		addErr(field+".retryLimit", "must not be negative")
+	}
+	if runnerSelector.Weight < 0 {
+		addErr(field+".weight", "must not be negative")
+	}
+	if runnerSelector.TenantLabel != "" {
+		for _, msg := range validation.IsQualifiedName(runnerSelector.TenantLabel) {
+			addErr(field+".tenantLabel", msg)
+		}
+	}
+	if runnerSelector.Overrides != nil {
+		runnerSelector.Overrides.validate(field+".overrides", addErr)
+	}
+	if runnerSelector.Filter != nil {
+		runnerSelector.Filter.compile(field+".filter", addErr)
+	}
+	if runnerSelector.Dedupe != nil {
+		runnerSelector.Dedupe.validate(field+".dedupe", addErr)
+	}
+	if runnerSelector.Callback != nil {
+		runnerSelector.Callback.validate(field+".callback", addErr)
+	}
+}
+
+//sortedKeys returns the keys of the map in sorted order to keep validation
+//output deterministic
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch typed := m.(type) {
+	case EventMap:
+		for k := range typed {
+			keys = append(keys, k)
+		}
+	case map[string]RunnerSelectors:
+		for k := range typed {
+			keys = append(keys, k)
+		}
+	case map[string]string:
+		for k := range typed {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
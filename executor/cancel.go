@@ -0,0 +1,125 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	queue "github.com/luqmanMohammed/k8s-events-runner/queue"
+	"github.com/luqmanMohammed/k8s-events-runner/runs"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+//recordCancelled records the run as cancelled
+func (pe K8sJobExecutor) recordCancelled(id, message string) error {
+	return pe.runStore.Update(id, func(run *runs.Run) {
+		run.Cancel(message)
+	})
+}
+
+//isCancelled reports whether the run of the job was cancelled, so that it is not dispatched
+func (pe K8sJobExecutor) isCancelled(jb *queue.Job) bool {
+	run, err := pe.runStore.Get(jb.ID)
+	return err == nil && run.Phase == runs.PhaseCancelled
+}
+
+//CancelRun cancels the run with the ID. Queued and delayed jobs are removed from the
+//queue, and the kubernetes Job of a dispatched run is deleted with foreground
+//propagation, so that its pods are deleted first. Runs which are being dispatched are
+//skipped by the executor once cancelled, or their just created Job is deleted. Queued
+//and delayed jobs without a run, e.g. jobs replayed after a restart with an in memory
+//run store, are removed as well. Returns runs.ErrRunNotFound or runs.ErrRunFinished if
+//the run cannot be cancelled.
+func (pe K8sJobExecutor) CancelRun(ctx context.Context, id string) error {
+	run, err := pe.runStore.Get(id)
+	if err != nil && !errors.Is(err, runs.ErrRunNotFound) {
+		return err
+	}
+	if run != nil && run.Phase.Finished() {
+		return runs.ErrRunFinished
+	}
+	if err := pe.jobQueue.Remove(id); err == nil {
+		klog.V(1).Infof("Cancelled queued run %s", id)
+		return pe.recordRemovedCancelled(id, "Removed from the job queue")
+	} else if !errors.Is(err, queue.ErrJobNotFound) {
+		return err
+	}
+	if jb, err := pe.delayQueue.Remove(id); err == nil {
+		if err := pe.jobQueue.Ack(jb); err != nil {
+			klog.Errorf("failed to acknowledge cancelled job %s: %v", id, err)
+		}
+		klog.V(1).Infof("Cancelled delayed run %s", id)
+		return pe.recordRemovedCancelled(id, "Removed from the delay queue")
+	}
+	if run == nil {
+		return runs.ErrRunNotFound
+	}
+	return pe.cancelDispatched(ctx, id)
+}
+
+//recordRemovedCancelled records the run of a job removed from the queue as cancelled.
+//Jobs without a run are removed without being recorded.
+func (pe K8sJobExecutor) recordRemovedCancelled(id, message string) error {
+	if err := pe.recordCancelled(id, message); err != nil && !errors.Is(err, runs.ErrRunNotFound) {
+		return err
+	}
+	return nil
+}
+
+//cancelDispatched cancels a run which was dequeued by an executor. The cancellation
+//is recorded before the kubernetes Job is deleted, so that the Job deletion is not
+//recorded as a failed run. The Job name is read while cancelling, so that either the
+//executor sees the cancelled run and deletes the Job it is creating, or the Job is
+//deleted here. The run is restored if the Job cannot be deleted.
+func (pe K8sJobExecutor) cancelDispatched(ctx context.Context, id string) error {
+	var previous *runs.Run
+	if err := pe.runStore.Update(id, func(run *runs.Run) {
+		if run.Phase.Finished() {
+			return
+		}
+		copied := *run
+		previous = &copied
+		if run.JobName == "" {
+			run.Cancel("Cancelled before the Job was created")
+		} else {
+			run.Cancel(fmt.Sprintf("Job %s was deleted", run.JobName))
+		}
+	}); err != nil {
+		return err
+	}
+	if previous == nil {
+		return runs.ErrRunFinished
+	}
+	if previous.JobName == "" {
+		klog.V(1).Infof("Cancelled run %s while it is being dispatched", id)
+		return nil
+	}
+	if err := pe.deleteJob(ctx, previous.JobName); err != nil {
+		pe.updateRun(id, func(run *runs.Run) {
+			if run.Phase != runs.PhaseCancelled {
+				return
+			}
+			run.Phase = previous.Phase
+			run.FinishedAt = previous.FinishedAt
+			run.Reason = previous.Reason
+			run.Message = previous.Message
+		})
+		return err
+	}
+	klog.V(1).Infof("Cancelled run %s by deleting Job %s", id, previous.JobName)
+	return nil
+}
+
+//deleteJob deletes the kubernetes Job with foreground propagation, so that its pods
+//are deleted first. Jobs which are already deleted are ignored.
+func (pe K8sJobExecutor) deleteJob(ctx context.Context, name string) error {
+	propagation := metav1.DeletePropagationForeground
+	if err := pe.k8sClientSet.BatchV1().Jobs(pe.namespace).Delete(ctx, name, metav1.DeleteOptions{
+		PropagationPolicy: &propagation,
+	}); err != nil && !k8serrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete Job %s: %v", name, err)
+	}
+	return nil
+}
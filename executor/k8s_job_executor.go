@@ -2,36 +2,85 @@ package executor
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"strconv"
-	"strings"
 	"sync"
 	"time"
 
 	queue "github.com/luqmanMohammed/k8s-events-runner/queue"
+	"github.com/luqmanMohammed/k8s-events-runner/runs"
 	"github.com/luqmanMohammed/k8s-events-runner/utils"
 	batchv1 "k8s.io/api/batch/v1"
 	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog/v2"
 )
 
+const (
+	//eventVolumeName is the name of the volume which contains the event payload
+	eventVolumeName = "er-event"
+	//eventMountPath is the path the event payload volume is mounted on in every container
+	eventMountPath = "/er/event"
+	//eventPayloadKey is the key of the event payload in the event Secret
+	eventPayloadKey = "event.json"
+	//eventSecretPrefix prefixes the job ID to name the event Secret of the job
+	eventSecretPrefix = "er-event-"
+)
+
 type K8sJobExecutor struct {
 	k8sClientSet       *kubernetes.Clientset
 	namespace          string
 	erPodIndentifier   string
 	jobQueue           queue.JobQueue
+	delayQueue         *queue.DelayQueue
+	deadLetters        queue.DeadLetterStore
+	runStore           runs.Store
+	retryPolicy        RetryPolicy
 	concurrencyTimeout time.Duration `default:"5m"`
 	manageCleanup      bool          `default:"false"`
 	cleanupTimeout     time.Duration `default:"1h"`
+	logLimitBytes      int           `default:"65536"`
 	completions        int32         `default:"1"`
 	executorCount      int           `default:"5"`
 }
 
-func New(k8sClientSet *kubernetes.Clientset, namespace, erPodIndentifier string, concurrencyTimeout, cleanupTimeout time.Duration, jobQueue queue.JobQueue) *K8sJobExecutor {
+//Options contains the configuration and dependencies of a K8sJobExecutor
+type Options struct {
+	//Namespace is the namespace kubernetes Jobs are created in
+	Namespace string
+	//PodIdentifier labels every Job created by this events runner
+	PodIdentifier string
+	//ExecutorCount is the number of jobs dispatched concurrently
+	ExecutorCount int
+	//ConcurrencyTimeout is the longest a job waits for a runner below its concurrency
+	//limit before it is checked again
+	ConcurrencyTimeout time.Duration
+	//CleanupTimeout is the time after which finished Jobs are deleted
+	CleanupTimeout time.Duration
+	//JobQueue is the queue jobs are dequeued from and acknowledged to
+	JobQueue queue.JobQueue
+	//DelayQueue parks jobs waiting for their concurrency limit or a dispatch retry
+	DelayQueue *queue.DelayQueue
+	//DeadLetters receives jobs which could not be dispatched within RetryPolicy
+	DeadLetters queue.DeadLetterStore
+	//RunStore records the state of the run of every job
+	RunStore runs.Store
+	//RetryPolicy configures how jobs which failed to be dispatched are retried
+	RetryPolicy RetryPolicy
+	//LogLimitBytes is the number of bytes of logs captured per container of finished
+	//runs, 0 disables capturing logs
+	LogLimitBytes int
+}
+
+//New instanciates a K8sJobExecutor with the provided options
+func New(k8sClientSet *kubernetes.Clientset, options Options) *K8sJobExecutor {
 	k8sMajorVersion, k8sMinorVersion, err := utils.GetKubeVersion(k8sClientSet)
 	if err != nil {
 		klog.Fatal(err)
@@ -39,13 +88,18 @@ func New(k8sClientSet *kubernetes.Clientset, namespace, erPodIndentifier string,
 
 	return &K8sJobExecutor{
 		k8sClientSet:       k8sClientSet,
-		namespace:          namespace,
-		erPodIndentifier:   erPodIndentifier,
-		jobQueue:           jobQueue,
-		concurrencyTimeout: concurrencyTimeout,
-		cleanupTimeout:     cleanupTimeout,
+		namespace:          options.Namespace,
+		erPodIndentifier:   options.PodIdentifier,
+		jobQueue:           options.JobQueue,
+		delayQueue:         options.DelayQueue,
+		deadLetters:        options.DeadLetters,
+		runStore:           options.RunStore,
+		retryPolicy:        options.RetryPolicy,
+		concurrencyTimeout: options.ConcurrencyTimeout,
+		cleanupTimeout:     options.CleanupTimeout,
+		logLimitBytes:      options.LogLimitBytes,
 		completions:        1,
-		executorCount:      5,
+		executorCount:      options.ExecutorCount,
 		manageCleanup:      k8sMajorVersion >= 1 && k8sMinorVersion >= 21,
 	}
 }
@@ -75,6 +129,52 @@ func (pe K8sJobExecutor) RunJobCleaner(ctx context.Context) {
 	inf.Start(ctx.Done())
 }
 
+//isJobFinished reports whether the kubernetes Job has completed or failed
+func isJobFinished(job *batchv1.Job) bool {
+	for _, condition := range job.Status.Conditions {
+		if (condition.Type == batchv1.JobComplete || condition.Type == batchv1.JobFailed) && condition.Status == v1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+//concurrencyKey identifies the jobs which share a concurrency limit, using the labels of the kubernetes Job
+func concurrencyKey(jobLabels map[string]string) string {
+	return fmt.Sprintf("%s:%s:%s", jobLabels["erResource"], jobLabels["erEventType"], jobLabels["erRunner"])
+}
+
+//StartJobWatcher runs an informer which records the state of kubernetes Jobs against
+//their runs, and releases jobs delayed by their concurrency limit as soon as a running
+//kubernetes Job of the same resource:event and runner finishes
+func (pe K8sJobExecutor) StartJobWatcher(ctx context.Context) {
+	inf := informers.NewSharedInformerFactoryWithOptions(pe.k8sClientSet, 0, informers.WithNamespace(pe.namespace), informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+		options.LabelSelector = fmt.Sprintf("erID=%s", pe.erPodIndentifier)
+	}))
+	inf.Batch().V1().Jobs().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			pe.recordJobStatus(ctx, obj.(*batchv1.Job))
+		},
+		UpdateFunc: func(old, new interface{}) {
+			oldJob, newJob := old.(*batchv1.Job), new.(*batchv1.Job)
+			pe.recordJobStatus(ctx, newJob)
+			if !isJobFinished(oldJob) && isJobFinished(newJob) {
+				pe.delayQueue.Release(concurrencyKey(newJob.Labels))
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if job, ok := obj.(*batchv1.Job); ok {
+				pe.recordJobDeleted(job)
+				pe.delayQueue.Release(concurrencyKey(job.Labels))
+			}
+		},
+	})
+	inf.Start(ctx.Done())
+}
+
 func (pe K8sJobExecutor) StartExecutors(ctx context.Context) {
 	wg := sync.WaitGroup{}
 	wg.Add(pe.executorCount)
@@ -86,8 +186,13 @@ func (pe K8sJobExecutor) StartExecutors(ctx context.Context) {
 					klog.Info("Pod executor is shutting down")
 					wg.Done()
 					return
-				case jb := <-pe.jobQueue:
-					klog.Infof("executing job %s:%s", jb.Resource, jb.EventType)
+				default:
+					jb, err := pe.jobQueue.Dequeue(ctx)
+					if err != nil {
+						continue
+					}
+					klog.Infof("executing job %s %s:%s with priority %d", jb.ID, jb.Resource, jb.EventType, jb.Priority)
+					klog.V(2).Infof("queued jobs by priority: %v", pe.jobQueue.LenByPriority())
 					pe.executeJob(ctx, jb)
 				}
 			}
@@ -101,7 +206,7 @@ func (pe K8sJobExecutor) checkConcurrency(ctx context.Context, jb *queue.Job) (b
 		return true, nil
 	}
 	jobList, err := pe.k8sClientSet.BatchV1().Jobs(pe.namespace).List(ctx, metav1.ListOptions{
-		LabelSelector: fmt.Sprintf("erID=%s,erEventType=%s,erResource=%s", pe.erPodIndentifier, jb.EventType, jb.Resource),
+		LabelSelector: labels.SelectorFromSet(pe.jobLabels(jb)).String(),
 		FieldSelector: "status.successful!=1",
 	})
 	if err != nil {
@@ -119,17 +224,76 @@ func (pe K8sJobExecutor) checkConcurrency(ctx context.Context, jb *queue.Job) (b
 	return true, nil
 }
 
-func (pe K8sJobExecutor) prepareJob(jb *queue.Job) batchv1.Job {
-	podTemplate := v1.PodTemplateSpec(*jb.RunnerTemplate)
+//jobLabels returns the labels used to identify jobs and objects created for a job
+func (pe K8sJobExecutor) jobLabels(jb *queue.Job) map[string]string {
+	return map[string]string{
+		"erID":        pe.erPodIndentifier,
+		"erEventType": utils.SanitizeLabelValue(jb.EventType),
+		"erResource":  utils.SanitizeLabelValue(jb.Resource),
+		"erRunner":    utils.SanitizeLabelValue(jb.Runner),
+	}
+}
+
+//eventEnvVars returns env vars which describe the event and the object that triggered the job
+func eventEnvVars(jb *queue.Job) []v1.EnvVar {
+	metadata, _ := jb.Object["metadata"].(map[string]interface{})
+	getMetadata := func(key string) string {
+		value, _ := metadata[key].(string)
+		return value
+	}
+	return []v1.EnvVar{
+		{Name: "ER_EVENT_TYPE", Value: jb.EventType},
+		{Name: "ER_RESOURCE", Value: jb.Resource},
+		{Name: "ER_OBJECT_NAME", Value: getMetadata("name")},
+		{Name: "ER_OBJECT_NAMESPACE", Value: getMetadata("namespace")},
+		{Name: "ER_OBJECT_UID", Value: getMetadata("uid")},
+		{Name: "ER_EVENT_PATH", Value: eventMountPath + "/" + eventPayloadKey},
+	}
+}
+
+//prepareEventSecret prepares a Secret containing the full json event payload which
+//is mounted into the runner pod
+func (pe K8sJobExecutor) prepareEventSecret(jb *queue.Job) (v1.Secret, error) {
+	payload, err := json.Marshal(jb.Event)
+	if err != nil {
+		return v1.Secret{}, err
+	}
+	return v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      eventSecretName(jb),
+			Namespace: pe.namespace,
+			Labels:    pe.jobLabels(jb),
+		},
+		Data: map[string][]byte{
+			eventPayloadKey: payload,
+		},
+	}, nil
+}
+
+func (pe K8sJobExecutor) prepareJob(jb *queue.Job, eventSecretName string) batchv1.Job {
+	podTemplate := *(*v1.PodTemplateSpec)(jb.RunnerTemplate).DeepCopy()
 	if len(podTemplate.Labels) == 0 {
 		podTemplate.Labels = make(map[string]string)
 	}
 	if len(podTemplate.Annotations) == 0 {
 		podTemplate.Annotations = make(map[string]string)
 	}
+	podTemplate.Labels[runIDLabel] = jb.ID
 	podTemplate.Spec.RestartPolicy = v1.RestartPolicyNever
+	podTemplate.Spec.Volumes = append(podTemplate.Spec.Volumes, v1.Volume{
+		Name: eventVolumeName,
+		VolumeSource: v1.VolumeSource{
+			Secret: &v1.SecretVolumeSource{SecretName: eventSecretName},
+		},
+	})
 	for i := range podTemplate.Spec.Containers {
 		podTemplate.Spec.Containers[i].ImagePullPolicy = v1.PullIfNotPresent
+		podTemplate.Spec.Containers[i].Env = append(podTemplate.Spec.Containers[i].Env, eventEnvVars(jb)...)
+		podTemplate.Spec.Containers[i].VolumeMounts = append(podTemplate.Spec.Containers[i].VolumeMounts, v1.VolumeMount{
+			Name:      eventVolumeName,
+			MountPath: eventMountPath,
+			ReadOnly:  true,
+		})
 	}
 	retries := int32(jb.RetryLimit)
 	cleanupTimeout := int32(pe.cleanupTimeout.Seconds())
@@ -138,14 +302,10 @@ func (pe K8sJobExecutor) prepareJob(jb *queue.Job) batchv1.Job {
 	if pe.manageCleanup {
 		jobAnnotations["erCleanTime"] = strconv.Itoa(int(time.Now().Add(pe.cleanupTimeout).Unix()))
 	}
-	jobLabels := utils.MergeStringStringMaps(podTemplate.Labels, map[string]string{
-		"erID":        pe.erPodIndentifier,
-		"erEventType": jb.EventType,
-		"erResource":  jb.Resource,
-	})
+	jobLabels := utils.MergeStringStringMaps(podTemplate.Labels, pe.jobLabels(jb))
 	k8sJob := batchv1.Job{
 		ObjectMeta: metav1.ObjectMeta{
-			GenerateName: strings.ToLower(fmt.Sprintf("%s-%s-%s-", jb.Resource, jb.EventType, jb.Runner)),
+			GenerateName: utils.SanitizeName(fmt.Sprintf("%s-%s-%s-", jb.Resource, jb.EventType, jb.Runner)),
 			Namespace:    pe.namespace,
 			Labels:       jobLabels,
 			Annotations:  jobAnnotations,
@@ -160,27 +320,140 @@ func (pe K8sJobExecutor) prepareJob(jb *queue.Job) batchv1.Job {
 	return k8sJob
 }
 
+//createJob creates the event payload Secret and the kubernetes Job for the job, and
+//records the Job against the run of the job. The Secret is created first, so that the
+//pods of the Job can mount it right away, and is then owned by the Job so that it is
+//garbage collected with the Job.
+func (pe *K8sJobExecutor) createJob(ctx context.Context, jb *queue.Job) error {
+	secretName, created, err := pe.createEventSecret(ctx, jb)
+	if err != nil {
+		return fmt.Errorf("failed to create event payload secret: %v", err)
+	}
+	k8sJob := pe.prepareJob(jb, secretName)
+	createdJob, err := pe.k8sClientSet.BatchV1().Jobs(pe.namespace).Create(ctx, &k8sJob, metav1.CreateOptions{})
+	if err != nil {
+		if created {
+			if err := pe.k8sClientSet.CoreV1().Secrets(pe.namespace).Delete(ctx, secretName, metav1.DeleteOptions{}); err != nil {
+				klog.V(2).ErrorS(err, "Failed to cleanup event payload secret "+secretName)
+			}
+		}
+		return fmt.Errorf("failed to create job: %v", err)
+	}
+	if err := pe.setEventSecretOwner(ctx, secretName, createdJob); err != nil {
+		klog.V(2).ErrorS(err, "Failed to set owner of event payload secret "+secretName)
+	}
+	if !pe.recordDispatched(jb, createdJob.Name) {
+		//the run was cancelled while the Job was being created
+		klog.V(1).Infof("Run %s was cancelled while being dispatched, deleting Job %s", jb.ID, createdJob.Name)
+		if err := pe.deleteJob(ctx, createdJob.Name); err != nil {
+			klog.Errorf("failed to delete Job %s of cancelled run %s: %v", createdJob.Name, jb.ID, err)
+		}
+	}
+	return nil
+}
+
+//createEventSecret creates the event Secret of the job and returns its name and
+//whether it was created. Secrets which already exist, e.g. when a job is replayed
+//after its Job was created, are reused.
+func (pe *K8sJobExecutor) createEventSecret(ctx context.Context, jb *queue.Job) (string, bool, error) {
+	eventSecret, err := pe.prepareEventSecret(jb)
+	if err != nil {
+		return "", false, err
+	}
+	_, err = pe.k8sClientSet.CoreV1().Secrets(pe.namespace).Create(ctx, &eventSecret, metav1.CreateOptions{})
+	if k8serrors.IsAlreadyExists(err) {
+		return eventSecret.Name, false, nil
+	}
+	return eventSecret.Name, err == nil, err
+}
+
+//setEventSecretOwner adds the kubernetes Job to the owners of the event Secret. Owner
+//references are merged by UID, so owners of reused Secrets are kept.
+func (pe *K8sJobExecutor) setEventSecretOwner(ctx context.Context, secretName string, owner *batchv1.Job) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"ownerReferences": []metav1.OwnerReference{jobOwnerReference(owner)},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = pe.k8sClientSet.CoreV1().Secrets(pe.namespace).Patch(ctx, secretName, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+//eventSecretName returns the name of the event Secret of the job. The name is derived
+//from the job ID, so that replayed jobs reuse the Secret.
+func eventSecretName(jb *queue.Job) string {
+	return utils.SanitizeName(eventSecretPrefix + jb.ID)
+}
+
+//jobOwnerReference returns an owner reference to the kubernetes Job
+func jobOwnerReference(job *batchv1.Job) metav1.OwnerReference {
+	return metav1.OwnerReference{
+		APIVersion: batchv1.SchemeGroupVersion.String(),
+		Kind:       "Job",
+		Name:       job.Name,
+		UID:        job.UID,
+	}
+}
+
+//retryJob delays the job with exponential backoff after a failed dispatch attempt. Jobs
+//which reached the retry limit are moved to the dead-letter store and acknowledged.
+//Jobs of cancelled runs are acknowledged without being retried or dead-lettered.
+func (pe *K8sJobExecutor) retryJob(jb *queue.Job, dispatchErr error) {
+	if pe.isCancelled(jb) {
+		//the run was cancelled while it was being dispatched
+		klog.V(1).Infof("Not retrying job %s of cancelled run: %v", jb.ID, dispatchErr)
+		if err := pe.jobQueue.Ack(jb); err != nil {
+			klog.Errorf("failed to acknowledge job %s: %v", jb.ID, err)
+		}
+		return
+	}
+	jb.Attempts++
+	jb.LastError = dispatchErr.Error()
+	if jb.Attempts < pe.retryPolicy.Limit {
+		delay := pe.retryPolicy.delay(jb.Attempts)
+		klog.Errorf("failed to dispatch job %s (attempt %d of %d), retrying in %s: %v", jb.ID, jb.Attempts, pe.retryPolicy.Limit, delay, dispatchErr)
+		pe.delayQueue.AddAfter(jb, "retry:"+jb.ID, delay)
+		return
+	}
+	klog.Errorf("failed to dispatch job %s after %d attempts, moving it to the dead-letter store: %v", jb.ID, jb.Attempts, dispatchErr)
+	if err := pe.deadLetters.Add(jb); err != nil {
+		//the job is not acknowledged, so persistent queues replay it on restart
+		klog.Errorf("failed to dead-letter job %s: %v", jb.ID, err)
+		return
+	}
+	pe.recordDeadLettered(jb)
+	if err := pe.jobQueue.Ack(jb); err != nil {
+		klog.Errorf("failed to acknowledge job %s: %v", jb.ID, err)
+	}
+}
+
+//executeJob creates the kubernetes Job for the job and acknowledges it. Jobs which
+//fail to be dispatched are retried and dead-lettered once the retry limit is reached.
+//Jobs of cancelled runs are acknowledged without being dispatched.
 func (pe *K8sJobExecutor) executeJob(ctx context.Context, jb *queue.Job) {
+	if pe.isCancelled(jb) {
+		klog.Infof("run of job %s was cancelled, skipping it", jb.ID)
+		if err := pe.jobQueue.Ack(jb); err != nil {
+			klog.Errorf("failed to acknowledge job %s: %v", jb.ID, err)
+		}
+		return
+	}
 	if ok, err := pe.checkConcurrency(ctx, jb); err != nil {
-		klog.Errorf("failed to check concurrency: %v", err)
+		pe.retryJob(jb, fmt.Errorf("failed to check concurrency: %v", err))
 		return
 	} else if !ok {
-		klog.Infof("concurrency limit reached, skipping job %s:%s and adding back into queue", jb.Resource, jb.EventType)
-		fmt.Println(pe.concurrencyTimeout)
-		timer := time.NewTimer(pe.concurrencyTimeout)
-		select {
-		case <-ctx.Done():
-			klog.Info("Pod executor is shutting down")
-			return
-		case <-timer.C:
-			klog.Info("Sleep interval done")
-			pe.jobQueue <- jb
-		}
+		klog.Infof("concurrency limit reached, delaying job %s:%s until a running job finishes or for %s", jb.Resource, jb.EventType, pe.concurrencyTimeout)
+		pe.delayQueue.AddAfter(jb, concurrencyKey(pe.jobLabels(jb)), pe.concurrencyTimeout)
 		return
 	}
-	k8sJob := pe.prepareJob(jb)
-	_, err := pe.k8sClientSet.BatchV1().Jobs(pe.namespace).Create(ctx, &k8sJob, metav1.CreateOptions{})
-	if err != nil {
-		klog.Error(err)
+	if err := pe.createJob(ctx, jb); err != nil {
+		pe.retryJob(jb, err)
+		return
+	}
+	if err := pe.jobQueue.Ack(jb); err != nil {
+		klog.Errorf("failed to acknowledge job %s: %v", jb.ID, err)
 	}
 }
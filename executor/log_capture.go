@@ -0,0 +1,93 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/luqmanMohammed/k8s-events-runner/runs"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+//tailBuffer keeps the last limit bytes written to it
+type tailBuffer struct {
+	limit     int
+	data      []byte
+	truncated bool
+}
+
+func (tb *tailBuffer) Write(p []byte) (int, error) {
+	tb.data = append(tb.data, p...)
+	if len(tb.data) > tb.limit {
+		tb.data = append(tb.data[:0], tb.data[len(tb.data)-tb.limit:]...)
+		tb.truncated = true
+	}
+	return len(p), nil
+}
+
+//logReadFactor bounds the bytes read from the API server for a container log to this
+//multiple of the kept bytes
+const logReadFactor = 16
+
+//containerLog fetches the log of the container, keeping the last logLimitBytes bytes.
+//Only the last logLimitBytes lines are requested, which hold at least the last
+//logLimitBytes bytes as every line ends with a newline. The read is capped at
+//logReadFactor times logLimitBytes, so that runners logging very long lines do not
+//hold up the capture, in which case the end of the capped read is kept.
+func (pe K8sJobExecutor) containerLog(ctx context.Context, pod *v1.Pod, container string) (runs.ContainerLog, error) {
+	tailLines := int64(pe.logLimitBytes)
+	limitBytes := int64(pe.logLimitBytes) * logReadFactor
+	stream, err := pe.k8sClientSet.CoreV1().Pods(pe.namespace).GetLogs(pod.Name, &v1.PodLogOptions{
+		Container:  container,
+		TailLines:  &tailLines,
+		LimitBytes: &limitBytes,
+	}).Stream(ctx)
+	if err != nil {
+		return runs.ContainerLog{}, err
+	}
+	defer stream.Close()
+	tail := &tailBuffer{limit: pe.logLimitBytes}
+	if _, err := io.Copy(tail, stream); err != nil {
+		return runs.ContainerLog{}, err
+	}
+	return runs.ContainerLog{
+		Pod:       pod.Name,
+		Container: container,
+		Log:       string(tail.data),
+		Truncated: tail.truncated,
+	}, nil
+}
+
+//captureLogs fetches the logs of all containers of all pods of the kubernetes Job and
+//stores them with the run, before the Job and its pods are cleaned up
+func (pe K8sJobExecutor) captureLogs(ctx context.Context, id, jobName string) {
+	podList, err := pe.k8sClientSet.CoreV1().Pods(pe.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("job-name=%s", jobName),
+	})
+	if err != nil {
+		klog.Errorf("Failed to list pods of Job %s to capture logs of run %s: %v", jobName, id, err)
+		return
+	}
+	logs := make([]runs.ContainerLog, 0)
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		for _, container := range append(pod.Spec.InitContainers, pod.Spec.Containers...) {
+			containerLog, err := pe.containerLog(ctx, pod, container.Name)
+			if err != nil {
+				klog.V(2).ErrorS(err, "Failed to capture logs of container "+container.Name+" of pod "+pod.Name)
+				continue
+			}
+			logs = append(logs, containerLog)
+		}
+	}
+	if err := pe.runStore.SaveLogs(id, logs); err != nil {
+		klog.Errorf("Failed to store logs of run %s: %v", id, err)
+		return
+	}
+	pe.updateRun(id, func(run *runs.Run) {
+		run.LogsCaptured = true
+	})
+	klog.V(2).Infof("Captured logs of %d containers of run %s", len(logs), id)
+}
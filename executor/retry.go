@@ -0,0 +1,27 @@
+package executor
+
+import (
+	"time"
+)
+
+//RetryPolicy configures how often jobs which fail to be dispatched are retried before
+//they are dead-lettered. The delay before each retry doubles, starting at Backoff and
+//capped at MaxBackoff.
+type RetryPolicy struct {
+	//Limit is the number of dispatch attempts before a job is dead-lettered
+	Limit      int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+//delay returns the delay before retrying a job which failed the provided number of attempts
+func (rp RetryPolicy) delay(attempts int) time.Duration {
+	delay := rp.Backoff
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if rp.MaxBackoff > 0 && delay >= rp.MaxBackoff {
+			return rp.MaxBackoff
+		}
+	}
+	return delay
+}
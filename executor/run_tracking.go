@@ -0,0 +1,180 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	queue "github.com/luqmanMohammed/k8s-events-runner/queue"
+	"github.com/luqmanMohammed/k8s-events-runner/runs"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+//runIDLabel is the label of kubernetes Jobs and runner pods which holds the run ID
+const runIDLabel = "erRunID"
+
+//updateRun applies the update to the run of the job. Runs which are not found, e.g.
+//jobs replayed after a restart with an in memory run store, are not recorded.
+func (pe K8sJobExecutor) updateRun(id string, update func(run *runs.Run)) {
+	if err := pe.runStore.Update(id, update); err != nil {
+		if errors.Is(err, runs.ErrRunNotFound) {
+			klog.V(2).Infof("Run %s not found, not recording its state", id)
+			return
+		}
+		klog.Errorf("Failed to record state of run %s: %v", id, err)
+	}
+}
+
+//recordDispatched records the kubernetes Job created for the job. Returns false if the
+//run already finished, e.g. it was cancelled while the Job was being created.
+func (pe K8sJobExecutor) recordDispatched(jb *queue.Job, jobName string) bool {
+	now := time.Now()
+	recorded := true
+	pe.updateRun(jb.ID, func(run *runs.Run) {
+		if run.Phase.Finished() {
+			recorded = false
+			return
+		}
+		run.Phase = runs.PhasePending
+		run.JobName = jobName
+		run.DispatchedAt = &now
+		run.DispatchAttempts = jb.Attempts
+	})
+	return recorded
+}
+
+//recordDeadLettered records that the job could not be dispatched, unless the run
+//already finished
+func (pe K8sJobExecutor) recordDeadLettered(jb *queue.Job) {
+	now := time.Now()
+	pe.updateRun(jb.ID, func(run *runs.Run) {
+		if run.Phase.Finished() {
+			return
+		}
+		run.Phase = runs.PhaseDeadLettered
+		run.FinishedAt = &now
+		run.Reason = "DispatchFailed"
+		run.Message = jb.LastError
+		run.DispatchAttempts = jb.Attempts
+	})
+}
+
+//jobRunPhase returns the run phase of the kubernetes Job along with the condition
+//which finished the Job, if any
+func jobRunPhase(job *batchv1.Job) (runs.Phase, *batchv1.JobCondition) {
+	for i, condition := range job.Status.Conditions {
+		if condition.Status != v1.ConditionTrue {
+			continue
+		}
+		switch condition.Type {
+		case batchv1.JobComplete:
+			return runs.PhaseSucceeded, &job.Status.Conditions[i]
+		case batchv1.JobFailed:
+			return runs.PhaseFailed, &job.Status.Conditions[i]
+		}
+	}
+	if job.Status.Active > 0 {
+		return runs.PhaseRunning, nil
+	}
+	return runs.PhasePending, nil
+}
+
+//failedContainer returns the termination state of the first container of the Job's
+//pods which exited with a non zero exit code
+func (pe K8sJobExecutor) failedContainer(ctx context.Context, job *batchv1.Job) *v1.ContainerStateTerminated {
+	podList, err := pe.k8sClientSet.CoreV1().Pods(pe.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("job-name=%s", job.Name),
+	})
+	if err != nil {
+		klog.V(2).ErrorS(err, "Failed to list pods of Job "+job.Name)
+		return nil
+	}
+	for _, pod := range podList.Items {
+		for _, status := range append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...) {
+			if terminated := status.State.Terminated; terminated != nil && terminated.ExitCode != 0 {
+				return terminated
+			}
+		}
+	}
+	return nil
+}
+
+//recordJobStatus records the state of the kubernetes Job against its run, and captures
+//the logs of the run once it finished. Runs which already finished are not updated.
+func (pe K8sJobExecutor) recordJobStatus(ctx context.Context, job *batchv1.Job) {
+	id, ok := job.Labels[runIDLabel]
+	if !ok {
+		return
+	}
+	run, err := pe.runStore.Get(id)
+	if err != nil || run.Phase.Finished() {
+		return
+	}
+	phase, condition := jobRunPhase(job)
+	var terminated *v1.ContainerStateTerminated
+	if phase == runs.PhaseFailed {
+		terminated = pe.failedContainer(ctx, job)
+	}
+	updated := false
+	pe.updateRun(id, func(run *runs.Run) {
+		//checked within the update, so that a run cancelled or finished concurrently is
+		//not overwritten
+		if run.Phase.Finished() {
+			return
+		}
+		updated = true
+		run.Phase = phase
+		run.JobName = job.Name
+		run.Retries = job.Status.Failed
+		if job.Status.StartTime != nil {
+			startedAt := job.Status.StartTime.Time
+			run.StartedAt = &startedAt
+		}
+		if condition != nil {
+			finishedAt := condition.LastTransitionTime.Time
+			if job.Status.CompletionTime != nil {
+				finishedAt = job.Status.CompletionTime.Time
+			}
+			run.FinishedAt = &finishedAt
+			run.Reason = condition.Reason
+			run.Message = condition.Message
+		}
+		if terminated != nil {
+			exitCode := terminated.ExitCode
+			run.ExitCode = &exitCode
+			run.ExitReason = terminated.Reason
+		}
+	})
+	if !updated {
+		return
+	}
+	klog.V(2).Infof("Run %s of Job %s is %s", id, job.Name, phase)
+	//logs are captured once, by the update which finished the run
+	if phase.Finished() && pe.logLimitBytes > 0 {
+		go pe.captureLogs(ctx, id, job.Name)
+	}
+}
+
+//recordJobDeleted records runs of kubernetes Jobs which were deleted before finishing as
+//failed. Runs which already finished, including cancelled runs whose Job is deleted by
+//CancelRun, are left as they are.
+func (pe K8sJobExecutor) recordJobDeleted(job *batchv1.Job) {
+	id, ok := job.Labels[runIDLabel]
+	if !ok {
+		return
+	}
+	now := time.Now()
+	pe.updateRun(id, func(run *runs.Run) {
+		if run.Phase.Finished() {
+			return
+		}
+		run.Phase = runs.PhaseFailed
+		run.FinishedAt = &now
+		run.Reason = "JobDeleted"
+		run.Message = fmt.Sprintf("Job %s was deleted before it finished", job.Name)
+	})
+}
@@ -3,8 +3,11 @@ module github.com/luqmanMohammed/k8s-events-runner
 go 1.17
 
 require (
+	github.com/fsnotify/fsnotify v1.5.1
 	github.com/spf13/cobra v1.2.1
 	github.com/spf13/viper v1.9.0
+	go.etcd.io/bbolt v1.3.6
+	go.etcd.io/bbolt v1.3.6
 	gopkg.in/yaml.v2 v2.4.0
 	k8s.io/api v0.22.3
 	k8s.io/apimachinery v0.22.3
@@ -14,7 +17,6 @@ require (
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/fsnotify/fsnotify v1.5.1 // indirect
 	github.com/go-logr/logr v0.4.0 // indirect
 	github.com/gogo/protobuf v1.3.2 // indirect
 	github.com/golang/protobuf v1.5.2 // indirect
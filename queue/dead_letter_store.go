@@ -0,0 +1,179 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	//ErrJobNotFound is returned when a job with the requested ID does not exist
+	ErrJobNotFound = errors.New("job not found")
+	//deadLettersBucket stores all dead-lettered jobs keyed by job ID
+	deadLettersBucket = []byte("deadLetters")
+)
+
+//DeadLetterStore keeps jobs which could not be dispatched after all retries, so that
+//they can be inspected and replayed
+type DeadLetterStore interface {
+	//Add stores the job as dead-lettered
+	Add(job *Job) error
+	//List returns all dead-lettered jobs in the order they were dead-lettered
+	List() ([]*Job, error)
+	//Get returns the dead-lettered job with the ID or ErrJobNotFound
+	Get(id string) (*Job, error)
+	//Remove deletes the dead-lettered job with the ID or returns ErrJobNotFound
+	Remove(id string) error
+}
+
+//sortDeadLetters sorts jobs in the order they were dead-lettered
+func sortDeadLetters(jobs []*Job) {
+	sort.SliceStable(jobs, func(i, j int) bool { return jobs[i].DeadLetteredAt.Before(jobs[j].DeadLetteredAt) })
+}
+
+//MemoryDeadLetterStore is an in memory DeadLetterStore. Jobs are lost when the process exits.
+type MemoryDeadLetterStore struct {
+	mutex sync.RWMutex
+	jobs  map[string]*Job
+}
+
+//NewMemoryDeadLetterStore instanciates a MemoryDeadLetterStore
+func NewMemoryDeadLetterStore() *MemoryDeadLetterStore {
+	return &MemoryDeadLetterStore{
+		jobs: make(map[string]*Job),
+	}
+}
+
+//Add stores the job as dead-lettered
+func (mdls *MemoryDeadLetterStore) Add(job *Job) error {
+	mdls.mutex.Lock()
+	defer mdls.mutex.Unlock()
+	job.DeadLetteredAt = time.Now()
+	mdls.jobs[job.ID] = job
+	return nil
+}
+
+//List returns all dead-lettered jobs in the order they were dead-lettered
+func (mdls *MemoryDeadLetterStore) List() ([]*Job, error) {
+	mdls.mutex.RLock()
+	defer mdls.mutex.RUnlock()
+	jobs := make([]*Job, 0, len(mdls.jobs))
+	for _, job := range mdls.jobs {
+		jobs = append(jobs, job)
+	}
+	sortDeadLetters(jobs)
+	return jobs, nil
+}
+
+//Get returns the dead-lettered job with the ID
+func (mdls *MemoryDeadLetterStore) Get(id string) (*Job, error) {
+	mdls.mutex.RLock()
+	defer mdls.mutex.RUnlock()
+	job, ok := mdls.jobs[id]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	return job, nil
+}
+
+//Remove deletes the dead-lettered job with the ID
+func (mdls *MemoryDeadLetterStore) Remove(id string) error {
+	mdls.mutex.Lock()
+	defer mdls.mutex.Unlock()
+	if _, ok := mdls.jobs[id]; !ok {
+		return ErrJobNotFound
+	}
+	delete(mdls.jobs, id)
+	return nil
+}
+
+//PersistentDeadLetterStore is a DeadLetterStore which stores jobs in an embedded bbolt
+//database, so that dead-lettered jobs survive restarts
+type PersistentDeadLetterStore struct {
+	db *bolt.DB
+}
+
+//NewPersistentDeadLetterStore opens or creates the database at the provided path
+func NewPersistentDeadLetterStore(path string) (*PersistentDeadLetterStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 10 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(deadLettersBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &PersistentDeadLetterStore{db: db}, nil
+}
+
+//Add stores the job as dead-lettered
+func (pdls *PersistentDeadLetterStore) Add(job *Job) error {
+	job.DeadLetteredAt = time.Now()
+	value, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return pdls.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(deadLettersBucket).Put([]byte(job.ID), value)
+	})
+}
+
+//List returns all dead-lettered jobs in the order they were dead-lettered
+func (pdls *PersistentDeadLetterStore) List() ([]*Job, error) {
+	var jobs []*Job
+	err := pdls.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(deadLettersBucket).ForEach(func(key, value []byte) error {
+			var job Job
+			if err := json.Unmarshal(value, &job); err != nil {
+				return err
+			}
+			jobs = append(jobs, &job)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortDeadLetters(jobs)
+	return jobs, nil
+}
+
+//Get returns the dead-lettered job with the ID
+func (pdls *PersistentDeadLetterStore) Get(id string) (*Job, error) {
+	var job *Job
+	err := pdls.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(deadLettersBucket).Get([]byte(id))
+		if value == nil {
+			return ErrJobNotFound
+		}
+		job = &Job{}
+		return json.Unmarshal(value, job)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+//Remove deletes the dead-lettered job with the ID
+func (pdls *PersistentDeadLetterStore) Remove(id string) error {
+	return pdls.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(deadLettersBucket)
+		if bucket.Get([]byte(id)) == nil {
+			return ErrJobNotFound
+		}
+		return bucket.Delete([]byte(id))
+	})
+}
+
+//Close closes the database
+func (pdls *PersistentDeadLetterStore) Close() error {
+	return pdls.db.Close()
+}
@@ -0,0 +1,77 @@
+package queue
+
+import (
+	"expvar"
+	"sync"
+	"time"
+)
+
+//dedupePruneInterval is the minimum interval between removals of expired windows
+const dedupePruneInterval = time.Minute
+
+//Deduplicator suppresses repeated events by key within a time window, so that bursts
+//of identical events collapse into a single job. The first event of a key opens the
+//window, all further events of the key are suppressed until the window expires.
+type Deduplicator struct {
+	mutex      sync.Mutex
+	windows    map[string]*dedupeWindow
+	suppressed *expvar.Map
+	lastPrune  time.Time
+}
+
+//dedupeWindow tracks the suppressed events of a key
+type dedupeWindow struct {
+	expiresAt  time.Time
+	suppressed int
+}
+
+//NewDeduplicator instanciates a Deduplicator. Suppressed event counts by runner are
+//published as metrics under the provided name, or not published if name is empty.
+func NewDeduplicator(name string) *Deduplicator {
+	dd := &Deduplicator{
+		windows:    make(map[string]*dedupeWindow),
+		suppressed: new(expvar.Map).Init(),
+		lastPrune:  time.Now(),
+	}
+	if name != "" {
+		expvar.Publish(name, dd.suppressed)
+	}
+	return dd
+}
+
+//Suppress reports whether an event with the key was already seen within the window, and
+//the number of events suppressed so far in that window. If the key was not seen, a new
+//window is opened for it.
+func (dd *Deduplicator) Suppress(runner, key string, window time.Duration) (bool, int) {
+	dd.mutex.Lock()
+	defer dd.mutex.Unlock()
+	now := time.Now()
+	dd.prune(now)
+	if dw, ok := dd.windows[key]; ok && now.Before(dw.expiresAt) {
+		dw.suppressed++
+		dd.suppressed.Add(runner, 1)
+		return true, dw.suppressed
+	}
+	dd.windows[key] = &dedupeWindow{expiresAt: now.Add(window)}
+	return false, 0
+}
+
+//Forget closes the window of the key, e.g. when the job for the key could not be queued
+func (dd *Deduplicator) Forget(key string) {
+	dd.mutex.Lock()
+	defer dd.mutex.Unlock()
+	delete(dd.windows, key)
+}
+
+//prune removes expired windows, at most once per dedupePruneInterval
+func (dd *Deduplicator) prune(now time.Time) {
+	if now.Sub(dd.lastPrune) < dedupePruneInterval {
+		return
+	}
+	for key, dw := range dd.windows {
+		if !now.Before(dw.expiresAt) {
+			delete(dd.windows, key)
+		}
+	}
+	dd.lastPrune = now
+}
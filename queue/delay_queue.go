@@ -0,0 +1,124 @@
+package queue
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+//DelayQueue parks dequeued jobs outside of the job queue, so that they do not tie up
+//executors while they wait. Parked jobs are handed back to the job queue with Nack
+//once their delay expires, or earlier when they are released by key.
+type DelayQueue struct {
+	mutex    sync.Mutex
+	jobQueue JobQueue
+	parked   map[string]*parkedJob
+}
+
+//parkedJob is a job waiting in the DelayQueue
+type parkedJob struct {
+	job       *Job
+	key       string
+	releaseAt time.Time
+	timer     *time.Timer
+}
+
+//NewDelayQueue instanciates a DelayQueue which hands jobs back to the job queue
+func NewDelayQueue(jobQueue JobQueue) *DelayQueue {
+	return &DelayQueue{
+		jobQueue: jobQueue,
+		parked:   make(map[string]*parkedJob),
+	}
+}
+
+//AddAfter parks the job until the delay expires or the key is released. The job no
+//longer counts against the capacity share of its fairness key while it is parked.
+func (dq *DelayQueue) AddAfter(job *Job, key string, delay time.Duration) {
+	dq.jobQueue.Park(job)
+	dq.mutex.Lock()
+	defer dq.mutex.Unlock()
+	pj := &parkedJob{
+		job:       job,
+		key:       key,
+		releaseAt: time.Now().Add(delay),
+	}
+	pj.timer = time.AfterFunc(delay, func() {
+		dq.release(pj)
+	})
+	dq.parked[job.ID] = pj
+}
+
+//release hands the parked job back to the job queue, unless it was already released
+func (dq *DelayQueue) release(pj *parkedJob) {
+	dq.mutex.Lock()
+	if dq.parked[pj.job.ID] != pj {
+		dq.mutex.Unlock()
+		return
+	}
+	delete(dq.parked, pj.job.ID)
+	pj.timer.Stop()
+	dq.mutex.Unlock()
+	if err := dq.jobQueue.Nack(pj.job); err != nil {
+		klog.Errorf("Failed to hand back delayed job %s: %v", pj.job.ID, err)
+	}
+}
+
+//Release hands all jobs parked with the key back to the job queue before their delay expires
+func (dq *DelayQueue) Release(key string) {
+	dq.mutex.Lock()
+	var released []*parkedJob
+	for _, pj := range dq.parked {
+		if pj.key == key {
+			released = append(released, pj)
+		}
+	}
+	dq.mutex.Unlock()
+	for _, pj := range released {
+		dq.release(pj)
+	}
+	if len(released) > 0 {
+		klog.V(2).Infof("Released %d delayed jobs for %s", len(released), key)
+	}
+}
+
+//DelayedJob is a job parked in the DelayQueue until ReleaseAt
+type DelayedJob struct {
+	*Job
+	ReleaseAt time.Time
+}
+
+//List returns all parked jobs, ordered by the time they are released
+func (dq *DelayQueue) List() []DelayedJob {
+	dq.mutex.Lock()
+	defer dq.mutex.Unlock()
+	jobs := make([]DelayedJob, 0, len(dq.parked))
+	for _, pj := range dq.parked {
+		jobs = append(jobs, DelayedJob{Job: pj.job, ReleaseAt: pj.releaseAt})
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ReleaseAt.Before(jobs[j].ReleaseAt) })
+	return jobs
+}
+
+//Remove removes the parked job with the ID without handing it back to the job queue
+//and returns it, or returns ErrJobNotFound. The job is still in flight in the job
+//queue and has to be acknowledged by the caller.
+func (dq *DelayQueue) Remove(id string) (*Job, error) {
+	dq.mutex.Lock()
+	defer dq.mutex.Unlock()
+	pj, ok := dq.parked[id]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	pj.timer.Stop()
+	delete(dq.parked, id)
+	return pj.job, nil
+}
+
+//Len returns the number of parked jobs
+func (dq *DelayQueue) Len() int {
+	dq.mutex.Lock()
+	defer dq.mutex.Unlock()
+	return len(dq.parked)
+}
@@ -0,0 +1,82 @@
+package queue
+
+//fairScheduler shares dequeues between fairness keys in proportion to their weights
+//using start-time fair queuing. Every dequeue of a key advances the virtual finish
+//time of the key by 1/weight, and the key with the lowest start time is served next.
+//Keys which were idle start at the current virtual time, so they cannot build up credit.
+type fairScheduler struct {
+	virtualTime float64
+	finish      map[string]float64
+}
+
+func newFairScheduler() *fairScheduler {
+	return &fairScheduler{
+		finish: make(map[string]float64),
+	}
+}
+
+//start returns the virtual start time of the next job of the key
+func (fs *fairScheduler) start(key string) float64 {
+	if finish, ok := fs.finish[key]; ok && finish > fs.virtualTime {
+		return finish
+	}
+	return fs.virtualTime
+}
+
+//serve records that a job of the key with the weight was dequeued
+func (fs *fairScheduler) serve(key string, weight int) {
+	start := fs.start(key)
+	fs.virtualTime = start
+	fs.finish[key] = start + 1/float64(weight)
+	for k, finish := range fs.finish {
+		if finish <= fs.virtualTime {
+			delete(fs.finish, k)
+		}
+	}
+}
+
+//capacityShares limits the number of in flight jobs of each fairness key to its share
+//of the capacity, in proportion to the weights of all keys with waiting or in flight
+//jobs. Shares are only enforced while jobs of more than one key are waiting, so that
+//a single key can use the whole capacity when no other key needs it.
+type capacityShares struct {
+	inflight map[string]int
+	limits   map[string]int
+}
+
+func newCapacityShares(capacity int, waiting []*Job, inflight map[string]*Job) capacityShares {
+	shares := capacityShares{inflight: make(map[string]int)}
+	weights := make(map[string]int)
+	addWeight := func(job *Job) string {
+		key := job.FairnessKey()
+		if weight := job.weight(); weight > weights[key] {
+			weights[key] = weight
+		}
+		return key
+	}
+	for _, job := range waiting {
+		addWeight(job)
+	}
+	if capacity <= 0 || len(weights) <= 1 {
+		return shares
+	}
+	for _, job := range inflight {
+		shares.inflight[addWeight(job)]++
+	}
+	totalWeight := 0
+	for _, weight := range weights {
+		totalWeight += weight
+	}
+	shares.limits = make(map[string]int, len(weights))
+	for key, weight := range weights {
+		//round up, so that every key can run at least one job
+		shares.limits[key] = (capacity*weight + totalWeight - 1) / totalWeight
+	}
+	return shares
+}
+
+//available reports whether a job of the key can be dequeued without exceeding its share
+func (cs capacityShares) available(key string) bool {
+	limit, ok := cs.limits[key]
+	return !ok || cs.inflight[key] < limit
+}
@@ -0,0 +1,155 @@
+package queue
+
+import (
+	"testing"
+
+	"github.com/luqmanMohammed/k8s-events-runner/config"
+)
+
+//newTestJob returns a job of the resource, which is its fairness key
+func newTestJob(id, resource string, priority, weight int) *Job {
+	return &Job{
+		ID: id,
+		RunnerConfig: config.RunnerConfig{
+			RunnerSelector: config.RunnerSelector{Runner: "runner", Priority: priority, Weight: weight},
+		},
+		Event: config.Event{Resource: resource},
+	}
+}
+
+func TestFairSchedulerServe(t *testing.T) {
+	tests := []struct {
+		name string
+		//keys are always backlogged, ties are broken in their order
+		keys    []string
+		weights map[string]int
+		serves  int
+		want    map[string]int
+	}{
+		{
+			name:    "equal weights alternate",
+			keys:    []string{"a", "b"},
+			weights: map[string]int{"a": 1, "b": 1},
+			serves:  6,
+			want:    map[string]int{"a": 3, "b": 3},
+		},
+		{
+			name:    "weights share dequeues proportionally",
+			keys:    []string{"a", "b"},
+			weights: map[string]int{"a": 1, "b": 3},
+			serves:  8,
+			want:    map[string]int{"a": 2, "b": 6},
+		},
+		{
+			name:    "three keys",
+			keys:    []string{"a", "b", "c"},
+			weights: map[string]int{"a": 1, "b": 2, "c": 3},
+			serves:  12,
+			want:    map[string]int{"a": 2, "b": 4, "c": 6},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := newFairScheduler()
+			got := make(map[string]int)
+			for i := 0; i < tt.serves; i++ {
+				next := tt.keys[0]
+				for _, key := range tt.keys[1:] {
+					if fs.start(key) < fs.start(next) {
+						next = key
+					}
+				}
+				fs.serve(next, tt.weights[next])
+				got[next]++
+			}
+			for key, want := range tt.want {
+				if got[key] != want {
+					t.Errorf("key %s served %d times, want %d (all: %v)", key, got[key], want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestFairSchedulerIdleKeyStartsAtVirtualTime(t *testing.T) {
+	fs := newFairScheduler()
+	for i := 0; i < 5; i++ {
+		fs.serve("a", 1)
+	}
+	if start := fs.start("b"); start != fs.virtualTime {
+		t.Fatalf("start of idle key = %v, want virtual time %v", start, fs.virtualTime)
+	}
+	if fs.start("a") <= fs.start("b") {
+		t.Errorf("busy key starts at %v, want later than idle key at %v", fs.start("a"), fs.start("b"))
+	}
+	fs.serve("b", 1)
+	if fs.start("a") > fs.start("b") {
+		t.Errorf("idle key built up credit, busy key starts at %v and idle key at %v", fs.start("a"), fs.start("b"))
+	}
+}
+
+func TestNewCapacityShares(t *testing.T) {
+	tests := []struct {
+		name      string
+		capacity  int
+		waiting   []*Job
+		inflight  []*Job
+		available map[string]bool
+	}{
+		{
+			name:      "disabled without capacity",
+			waiting:   []*Job{newTestJob("a2", "a", 0, 1), newTestJob("b1", "b", 0, 1)},
+			inflight:  []*Job{newTestJob("a1", "a", 0, 1), newTestJob("a0", "a", 0, 1)},
+			available: map[string]bool{"resource/a": true, "resource/b": true},
+		},
+		{
+			name:      "single waiting key uses the whole capacity",
+			capacity:  2,
+			waiting:   []*Job{newTestJob("a3", "a", 0, 1)},
+			inflight:  []*Job{newTestJob("a1", "a", 0, 1), newTestJob("a2", "a", 0, 1)},
+			available: map[string]bool{"resource/a": true},
+		},
+		{
+			name:      "equal weights share the capacity",
+			capacity:  4,
+			waiting:   []*Job{newTestJob("a3", "a", 0, 1), newTestJob("b2", "b", 0, 1)},
+			inflight:  []*Job{newTestJob("a1", "a", 0, 1), newTestJob("a2", "a", 0, 1), newTestJob("b1", "b", 0, 1)},
+			available: map[string]bool{"resource/a": false, "resource/b": true},
+		},
+		{
+			name:      "shares follow weights",
+			capacity:  4,
+			waiting:   []*Job{newTestJob("a2", "a", 0, 1), newTestJob("b3", "b", 0, 3)},
+			inflight:  []*Job{newTestJob("a1", "a", 0, 1), newTestJob("b1", "b", 0, 3), newTestJob("b2", "b", 0, 3)},
+			available: map[string]bool{"resource/a": false, "resource/b": true},
+		},
+		{
+			name:      "shares are rounded up",
+			capacity:  3,
+			waiting:   []*Job{newTestJob("a2", "a", 0, 1), newTestJob("b1", "b", 0, 1)},
+			inflight:  []*Job{newTestJob("a1", "a", 0, 1)},
+			available: map[string]bool{"resource/a": true, "resource/b": true},
+		},
+		{
+			name:      "in flight keys which are not waiting take a share",
+			capacity:  3,
+			waiting:   []*Job{newTestJob("a1", "a", 0, 1), newTestJob("b2", "b", 0, 1)},
+			inflight:  []*Job{newTestJob("b1", "b", 0, 1), newTestJob("c1", "c", 0, 1)},
+			available: map[string]bool{"resource/a": true, "resource/b": false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inflight := make(map[string]*Job)
+			for _, job := range tt.inflight {
+				inflight[job.ID] = job
+			}
+			shares := newCapacityShares(tt.capacity, tt.waiting, inflight)
+			for key, want := range tt.available {
+				if got := shares.available(key); got != want {
+					t.Errorf("available(%s) = %v, want %v", key, got, want)
+				}
+			}
+		})
+	}
+}
@@ -1,9 +1,53 @@
 package queue
 
-import "github.com/luqmanMohammed/k8s-events-runner/config"
+import (
+	"time"
 
+	"github.com/luqmanMohammed/k8s-events-runner/config"
+	"github.com/luqmanMohammed/k8s-events-runner/utils"
+)
+
+//Job is a runner config along with the event which triggered it. Attempts and
+//LastError record failed attempts to dispatch the job.
 type Job struct {
+	ID             string    `json:"id"`
+	EnqueuedAt     time.Time `json:"enqueuedAt"`
+	Attempts       int       `json:"attempts,omitempty"`
+	LastError      string    `json:"lastError,omitempty"`
+	DeadLetteredAt time.Time `json:"deadLetteredAt,omitempty"`
 	config.RunnerConfig
-	EventType string
-	Resource  string
+	config.Event
+}
+
+//NewJob creates a Job with a unique ID for the runner config and event
+func NewJob(runnerConfig config.RunnerConfig, event config.Event) *Job {
+	return &Job{
+		ID:           utils.NewID(),
+		RunnerConfig: runnerConfig,
+		Event:        event,
+	}
+}
+
+//FairnessKey returns the key jobs are fairly scheduled by. It is the value of the
+//tenant label of the event object if the runner selector configures one and the
+//object has the label, otherwise the resource of the event.
+func (j *Job) FairnessKey() string {
+	if j.TenantLabel != "" {
+		if metadata, ok := j.Object["metadata"].(map[string]interface{}); ok {
+			if objLabels, ok := metadata["labels"].(map[string]interface{}); ok {
+				if tenant, ok := objLabels[j.TenantLabel].(string); ok {
+					return "tenant/" + tenant
+				}
+			}
+		}
+	}
+	return "resource/" + j.Resource
+}
+
+//weight returns the fair scheduling weight of the job, at least 1
+func (j *Job) weight() int {
+	if j.Weight < 1 {
+		return 1
+	}
+	return j.Weight
 }
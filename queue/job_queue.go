@@ -1,11 +1,412 @@
 package queue
 
-type JobQueue chan *Job
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
 
-func (jq *JobQueue) AddJob(job *Job) {
-	*jq <- job
+var (
+	//ErrQueueFull is returned by Enqueue when the queue has no space left for the jobs
+	//within the wait allowed by the context
+	ErrQueueFull = errors.New("job queue is full")
+)
+
+//JobQueue is implemented by all job queue backends. Jobs with a higher priority are
+//dequeued first, jobs of the same priority are shared fairly between fairness keys,
+//see Job.FairnessKey. Dequeued jobs must either be acknowledged with Ack once they have
+//been handled, or handed back with Nack to be dequeued again. Backends which persist
+//jobs replay jobs which were not acknowledged.
+type JobQueue interface {
+	//Enqueue adds all or none of the jobs to the queue. If the queue is full, Enqueue
+	//waits for space until the context is done and then returns ErrQueueFull.
+	Enqueue(ctx context.Context, jobs ...*Job) error
+	//Dequeue blocks until a job is available or the context is done
+	Dequeue(ctx context.Context) (*Job, error)
+	//Ack marks a dequeued job as handled and removes it from the queue
+	Ack(job *Job) error
+	//Nack hands a dequeued job back to the queue so that it is dequeued again.
+	//Nack never blocks, jobs are handed back even if the queue is full.
+	Nack(job *Job) error
+	//Park marks a dequeued job as waiting outside of the queue, e.g. in the DelayQueue,
+	//so that it does not use up the capacity share of its fairness key. Parked jobs
+	//must still be acknowledged with Ack or handed back with Nack.
+	Park(job *Job)
+	//Len returns the number of jobs waiting to be dequeued
+	Len() int
+	//LenByPriority returns the number of jobs waiting to be dequeued for each priority
+	LenByPriority() map[int]int
+	//List returns the jobs waiting to be dequeued in the order they were queued
+	List() []*Job
+	//Remove removes the job with the ID from the jobs waiting to be dequeued or
+	//returns ErrJobNotFound
+	Remove(id string) error
+	//Pause stops jobs of the runner from being dequeued, or all jobs if runner is empty
+	Pause(runner string)
+	//Resume resumes dequeuing jobs of the runner, or all jobs if runner is empty
+	Resume(runner string)
+	//Paused returns whether dequeuing is paused for all jobs and the paused runners
+	Paused() PauseState
+}
+
+//PauseState describes whether dequeuing jobs is paused
+type PauseState struct {
+	All     bool     `json:"all"`
+	Runners []string `json:"runners"`
+}
+
+//Options contains the configuration of a job queue backend
+type Options struct {
+	//Size is the maximum number of jobs waiting to be dequeued, 0 for unlimited
+	Size int
+	//Path is the file used by backends which persist jobs
+	Path string
+	//AgingInterval is the time after which a waiting job is treated as one priority
+	//higher, so that low priority jobs are not starved. 0 disables aging.
+	AgingInterval time.Duration
+	//Capacity is the number of jobs which are handled concurrently, i.e. the number of
+	//executors. Each fairness key gets a share of the capacity in proportion to its
+	//weight while other keys are waiting. 0 disables capacity shares.
+	Capacity int
+}
+
+//BackendFactory creates a job queue backend with the provided options
+type BackendFactory func(options Options) (JobQueue, error)
+
+var (
+	backendsMutex sync.RWMutex
+	backends      = make(map[string]BackendFactory)
+)
+
+//RegisterBackend makes a job queue backend available by name to New.
+//Backends are expected to register themselves in an init function.
+func RegisterBackend(name string, factory BackendFactory) {
+	backendsMutex.Lock()
+	defer backendsMutex.Unlock()
+	if _, ok := backends[name]; ok {
+		panic(fmt.Sprintf("job queue backend %q is already registered", name))
+	}
+	backends[name] = factory
+}
+
+//Backends returns the names of all registered job queue backends
+func Backends() []string {
+	backendsMutex.RLock()
+	defer backendsMutex.RUnlock()
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//New creates a job queue using the backend registered with the provided name
+func New(backend string, options Options) (JobQueue, error) {
+	backendsMutex.RLock()
+	factory, ok := backends[backend]
+	backendsMutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown job queue backend %q, available backends: %v", backend, Backends())
+	}
+	return factory(options)
+}
+
+func init() {
+	RegisterBackend("memory", func(options Options) (JobQueue, error) {
+		return NewMemoryJobQueue(options), nil
+	})
+}
+
+//MemoryJobQueue is an in memory JobQueue. Jobs are lost when the process exits.
+type MemoryJobQueue struct {
+	mutex         sync.Mutex
+	size          int
+	agingInterval time.Duration
+	capacity      int
+	fairness      *fairScheduler
+	pending       []*Job
+	//inflight holds the dequeued jobs which are being handled, parked jobs are excluded
+	inflight      map[string]*Job
+	paused        bool
+	pausedRunners map[string]bool
+	ready         chan struct{}
+	space         chan struct{}
+}
+
+//NewMemoryJobQueue instanciates a MemoryJobQueue which holds up to options.Size jobs
+//waiting to be dequeued, 0 for unlimited
+func NewMemoryJobQueue(options Options) *MemoryJobQueue {
+	return &MemoryJobQueue{
+		size:          options.Size,
+		agingInterval: options.AgingInterval,
+		capacity:      options.Capacity,
+		fairness:      newFairScheduler(),
+		inflight:      make(map[string]*Job),
+		pausedRunners: make(map[string]bool),
+		ready:         make(chan struct{}, 1),
+		space:         make(chan struct{}, 1),
+	}
+}
+
+//signal wakes up a waiting Dequeue or Enqueue without blocking
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+//hasSpace reports whether count more jobs fit into the queue
+func (mjq *MemoryJobQueue) hasSpace(count int) bool {
+	return mjq.size <= 0 || len(mjq.pending)+count <= mjq.size
+}
+
+//push adds the job to the end of the queue. Jobs which are handed back with Nack
+//are no longer considered in flight.
+func (mjq *MemoryJobQueue) push(job *Job) {
+	mjq.mutex.Lock()
+	defer mjq.mutex.Unlock()
+	if job.EnqueuedAt.IsZero() {
+		job.EnqueuedAt = time.Now()
+	}
+	delete(mjq.inflight, job.ID)
+	mjq.pending = append(mjq.pending, job)
+	signal(mjq.ready)
+}
+
+//enqueue waits until all jobs fit into the queue, persists them with the optional
+//persist func and adds them to the end of the queue
+func (mjq *MemoryJobQueue) enqueue(ctx context.Context, jobs []*Job, persist func([]*Job) error) error {
+	if mjq.size > 0 && len(jobs) > mjq.size {
+		return ErrQueueFull
+	}
+	for {
+		mjq.mutex.Lock()
+		if mjq.hasSpace(len(jobs)) {
+			break
+		}
+		mjq.mutex.Unlock()
+		select {
+		case <-ctx.Done():
+			return ErrQueueFull
+		case <-mjq.space:
+		}
+	}
+	defer mjq.mutex.Unlock()
+	now := time.Now()
+	for _, job := range jobs {
+		if job.EnqueuedAt.IsZero() {
+			job.EnqueuedAt = now
+		}
+	}
+	if persist != nil {
+		if err := persist(jobs); err != nil {
+			return err
+		}
+	}
+	mjq.pending = append(mjq.pending, jobs...)
+	signal(mjq.ready)
+	if mjq.hasSpace(1) {
+		//space is left, wake up the next waiting Enqueue
+		signal(mjq.space)
+	}
+	return nil
+}
+
+//Enqueue adds all or none of the jobs to the end of the queue, waiting for space
+//until the context is done
+func (mjq *MemoryJobQueue) Enqueue(ctx context.Context, jobs ...*Job) error {
+	return mjq.enqueue(ctx, jobs, nil)
+}
+
+//effectivePriority returns the priority of the job raised by one for every aging
+//interval the job has been waiting
+func (mjq *MemoryJobQueue) effectivePriority(job *Job, now time.Time) int {
+	if mjq.agingInterval <= 0 {
+		return job.Priority
+	}
+	return job.Priority + int(now.Sub(job.EnqueuedAt)/mjq.agingInterval)
+}
+
+//next returns the index of the job with the highest effective priority, skipping jobs
+//of paused runners and of fairness keys which used up their share of the capacity.
+//Of the jobs with the same effective priority, the job of the fairness key which was
+//served least relative to its weight is dequeued, in the order they were queued.
+//-1 is returned if no job can be dequeued.
+func (mjq *MemoryJobQueue) next() int {
+	if mjq.paused {
+		return -1
+	}
+	now := time.Now()
+	var eligible []*Job
+	for _, job := range mjq.pending {
+		if !mjq.pausedRunners[job.Runner] {
+			eligible = append(eligible, job)
+		}
+	}
+	shares := newCapacityShares(mjq.capacity, eligible, mjq.inflight)
+	next, nextPriority, nextStart := -1, 0, 0.0
+	for i, job := range mjq.pending {
+		if mjq.pausedRunners[job.Runner] {
+			continue
+		}
+		key := job.FairnessKey()
+		if !shares.available(key) {
+			continue
+		}
+		priority, start := mjq.effectivePriority(job, now), mjq.fairness.start(key)
+		if next == -1 || priority > nextPriority || (priority == nextPriority && start < nextStart) {
+			next, nextPriority, nextStart = i, priority, start
+		}
+	}
+	return next
+}
+
+//removeAt removes the pending job at the index
+func (mjq *MemoryJobQueue) removeAt(i int) *Job {
+	job := mjq.pending[i]
+	copy(mjq.pending[i:], mjq.pending[i+1:])
+	mjq.pending[len(mjq.pending)-1] = nil
+	mjq.pending = mjq.pending[:len(mjq.pending)-1]
+	return job
+}
+
+//tryDequeue removes the job with the highest effective priority from the queue and
+//marks it as in flight
+func (mjq *MemoryJobQueue) tryDequeue() (*Job, bool) {
+	mjq.mutex.Lock()
+	defer mjq.mutex.Unlock()
+	next := mjq.next()
+	if next == -1 {
+		return nil, false
+	}
+	job := mjq.removeAt(next)
+	mjq.fairness.serve(job.FairnessKey(), job.weight())
+	mjq.inflight[job.ID] = job
+	if len(mjq.pending) > 0 {
+		//more jobs are waiting, wake up the next waiting Dequeue
+		signal(mjq.ready)
+	}
+	signal(mjq.space)
+	return job, true
+}
+
+//Dequeue blocks until a job is available or the context is done and returns the
+//job with the highest effective priority
+func (mjq *MemoryJobQueue) Dequeue(ctx context.Context) (*Job, error) {
+	for {
+		if job, ok := mjq.tryDequeue(); ok {
+			return job, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-mjq.ready:
+		}
+	}
+}
+
+//Ack marks the job as handled
+func (mjq *MemoryJobQueue) Ack(job *Job) error {
+	mjq.mutex.Lock()
+	defer mjq.mutex.Unlock()
+	delete(mjq.inflight, job.ID)
+	//the capacity share of the job is freed, wake up a waiting Dequeue
+	signal(mjq.ready)
+	return nil
+}
+
+//Nack adds the job back to the queue, keeping its priority and enqueue time
+func (mjq *MemoryJobQueue) Nack(job *Job) error {
+	mjq.push(job)
+	return nil
+}
+
+//Park stops counting the dequeued job against the capacity share of its fairness key
+func (mjq *MemoryJobQueue) Park(job *Job) {
+	mjq.mutex.Lock()
+	defer mjq.mutex.Unlock()
+	delete(mjq.inflight, job.ID)
+	//the capacity share of the job is freed, wake up a waiting Dequeue
+	signal(mjq.ready)
+}
+
+//Len returns the number of jobs waiting to be dequeued
+func (mjq *MemoryJobQueue) Len() int {
+	mjq.mutex.Lock()
+	defer mjq.mutex.Unlock()
+	return len(mjq.pending)
+}
+
+//LenByPriority returns the number of jobs waiting to be dequeued for each priority
+func (mjq *MemoryJobQueue) LenByPriority() map[int]int {
+	mjq.mutex.Lock()
+	defer mjq.mutex.Unlock()
+	depth := make(map[int]int)
+	for _, job := range mjq.pending {
+		depth[job.Priority]++
+	}
+	return depth
+}
+
+//List returns the jobs waiting to be dequeued in the order they were queued
+func (mjq *MemoryJobQueue) List() []*Job {
+	mjq.mutex.Lock()
+	defer mjq.mutex.Unlock()
+	jobs := make([]*Job, len(mjq.pending))
+	copy(jobs, mjq.pending)
+	return jobs
+}
+
+//Remove removes the job with the ID from the jobs waiting to be dequeued
+func (mjq *MemoryJobQueue) Remove(id string) error {
+	mjq.mutex.Lock()
+	defer mjq.mutex.Unlock()
+	for i, job := range mjq.pending {
+		if job.ID == id {
+			mjq.removeAt(i)
+			signal(mjq.space)
+			return nil
+		}
+	}
+	return ErrJobNotFound
+}
+
+//Pause stops jobs of the runner from being dequeued, or all jobs if runner is empty
+func (mjq *MemoryJobQueue) Pause(runner string) {
+	mjq.mutex.Lock()
+	defer mjq.mutex.Unlock()
+	if runner == "" {
+		mjq.paused = true
+		return
+	}
+	mjq.pausedRunners[runner] = true
+}
+
+//Resume resumes dequeuing jobs of the runner, or all jobs if runner is empty
+func (mjq *MemoryJobQueue) Resume(runner string) {
+	mjq.mutex.Lock()
+	defer mjq.mutex.Unlock()
+	if runner == "" {
+		mjq.paused = false
+	} else {
+		delete(mjq.pausedRunners, runner)
+	}
+	signal(mjq.ready)
 }
 
-func NewJobQueue(queueSize int) JobQueue {
-	return make(JobQueue, queueSize)
+//Paused returns whether dequeuing is paused for all jobs and the paused runners
+func (mjq *MemoryJobQueue) Paused() PauseState {
+	mjq.mutex.Lock()
+	defer mjq.mutex.Unlock()
+	state := PauseState{All: mjq.paused, Runners: make([]string, 0, len(mjq.pausedRunners))}
+	for runner := range mjq.pausedRunners {
+		state.Runners = append(state.Runners, runner)
+	}
+	sort.Strings(state.Runners)
+	return state
 }
@@ -0,0 +1,182 @@
+package queue
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+//dequeueAll dequeues jobs without acknowledging them until no job can be dequeued
+//and returns their IDs
+func dequeueAll(mjq *MemoryJobQueue) []string {
+	var ids []string
+	for {
+		job, ok := mjq.tryDequeue()
+		if !ok {
+			return ids
+		}
+		ids = append(ids, job.ID)
+	}
+}
+
+func TestMemoryJobQueueDequeueOrder(t *testing.T) {
+	now := time.Now()
+	enqueuedAt := func(job *Job, ago time.Duration) *Job {
+		job.EnqueuedAt = now.Add(-ago)
+		return job
+	}
+	withRunner := func(job *Job, runner string) *Job {
+		job.Runner = runner
+		return job
+	}
+	tests := []struct {
+		name    string
+		options Options
+		jobs    []*Job
+		paused  []string
+		want    []string
+	}{
+		{
+			name: "same priority in the order queued",
+			jobs: []*Job{newTestJob("a1", "a", 0, 1), newTestJob("a2", "a", 0, 1), newTestJob("a3", "a", 0, 1)},
+			want: []string{"a1", "a2", "a3"},
+		},
+		{
+			name: "higher priority first",
+			jobs: []*Job{newTestJob("low", "a", 0, 1), newTestJob("high", "a", 2, 1), newTestJob("medium", "a", 1, 1)},
+			want: []string{"high", "medium", "low"},
+		},
+		{
+			name:    "waiting jobs age into a higher priority",
+			options: Options{AgingInterval: time.Minute},
+			jobs: []*Job{
+				enqueuedAt(newTestJob("new", "a", 2, 1), 0),
+				enqueuedAt(newTestJob("old", "a", 0, 1), 3*time.Minute),
+				enqueuedAt(newTestJob("older", "a", 0, 1), time.Minute+time.Second),
+			},
+			want: []string{"old", "new", "older"},
+		},
+		{
+			name:   "jobs of paused runners are skipped",
+			jobs:   []*Job{withRunner(newTestJob("p1", "a", 1, 1), "paused"), newTestJob("a1", "a", 0, 1), withRunner(newTestJob("p2", "a", 0, 1), "paused")},
+			paused: []string{"paused"},
+			want:   []string{"a1"},
+		},
+		{
+			name:   "nothing is dequeued while all runners are paused",
+			jobs:   []*Job{newTestJob("a1", "a", 0, 1)},
+			paused: []string{""},
+		},
+		{
+			name: "keys alternate with equal weights",
+			jobs: []*Job{newTestJob("a1", "a", 0, 1), newTestJob("a2", "a", 0, 1), newTestJob("b1", "b", 0, 1), newTestJob("b2", "b", 0, 1)},
+			want: []string{"a1", "b1", "a2", "b2"},
+		},
+		{
+			name: "keys share dequeues by weight",
+			jobs: []*Job{
+				newTestJob("a1", "a", 0, 1), newTestJob("a2", "a", 0, 1),
+				newTestJob("b1", "b", 0, 3), newTestJob("b2", "b", 0, 3), newTestJob("b3", "b", 0, 3), newTestJob("b4", "b", 0, 3),
+			},
+			want: []string{"a1", "b1", "b2", "b3", "a2", "b4"},
+		},
+		{
+			name: "priority wins over weights",
+			jobs: []*Job{newTestJob("b1", "b", 0, 3), newTestJob("a1", "a", 1, 1), newTestJob("a2", "a", 1, 1)},
+			want: []string{"a1", "a2", "b1"},
+		},
+		{
+			name:    "keys are limited to their share of the capacity",
+			options: Options{Capacity: 2},
+			jobs:    []*Job{newTestJob("a1", "a", 1, 1), newTestJob("a2", "a", 1, 1), newTestJob("b1", "b", 0, 1), newTestJob("b2", "b", 0, 1)},
+			want:    []string{"a1", "b1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mjq := NewMemoryJobQueue(tt.options)
+			for _, runner := range tt.paused {
+				mjq.Pause(runner)
+			}
+			if err := mjq.Enqueue(context.Background(), tt.jobs...); err != nil {
+				t.Fatalf("Enqueue() error = %v", err)
+			}
+			if got := dequeueAll(mjq); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("dequeued %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryJobQueueCapacityShares(t *testing.T) {
+	tests := []struct {
+		name string
+		//finish is applied to the first dequeued job
+		finish func(mjq *MemoryJobQueue, dq *DelayQueue, job *Job)
+		want   []string
+	}{
+		{
+			name:   "executing jobs use up the share",
+			finish: func(mjq *MemoryJobQueue, dq *DelayQueue, job *Job) {},
+			want:   []string{"b1"},
+		},
+		{
+			name: "acknowledged jobs free the share",
+			finish: func(mjq *MemoryJobQueue, dq *DelayQueue, job *Job) {
+				mjq.Ack(job)
+			},
+			want: []string{"a2", "b1", "b2"},
+		},
+		{
+			name: "parked jobs free the share",
+			finish: func(mjq *MemoryJobQueue, dq *DelayQueue, job *Job) {
+				dq.AddAfter(job, "key", time.Hour)
+			},
+			want: []string{"a2", "b1", "b2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mjq := NewMemoryJobQueue(Options{Capacity: 2})
+			dq := NewDelayQueue(mjq)
+			if err := mjq.Enqueue(context.Background(), newTestJob("a1", "a", 1, 1)); err != nil {
+				t.Fatalf("Enqueue() error = %v", err)
+			}
+			job, ok := mjq.tryDequeue()
+			if !ok {
+				t.Fatalf("no job dequeued")
+			}
+			tt.finish(mjq, dq, job)
+			if err := mjq.Enqueue(context.Background(), newTestJob("a2", "a", 1, 1), newTestJob("b1", "b", 0, 1), newTestJob("b2", "b", 0, 1)); err != nil {
+				t.Fatalf("Enqueue() error = %v", err)
+			}
+			if got := dequeueAll(mjq); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("dequeued %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryJobQueueReleasedJobIsDequeuedAgain(t *testing.T) {
+	mjq := NewMemoryJobQueue(Options{Capacity: 2})
+	dq := NewDelayQueue(mjq)
+	if err := mjq.Enqueue(context.Background(), newTestJob("a1", "a", 0, 1)); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	job, _ := mjq.tryDequeue()
+	dq.AddAfter(job, "key", time.Hour)
+	if mjq.Len() != 0 || dq.Len() != 1 {
+		t.Fatalf("queue has %d jobs and delay queue %d, want 0 and 1", mjq.Len(), dq.Len())
+	}
+	dq.Release("key")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	released, err := mjq.Dequeue(ctx)
+	if err != nil {
+		t.Fatalf("Dequeue() error = %v", err)
+	}
+	if released.ID != "a1" {
+		t.Errorf("dequeued %s, want a1", released.ID)
+	}
+}
@@ -0,0 +1,22 @@
+package queue
+
+import (
+	"expvar"
+)
+
+//queueMetrics is the snapshot of a job queue published as metrics
+type queueMetrics struct {
+	Length        int         `json:"length"`
+	LenByPriority map[int]int `json:"lenByPriority"`
+}
+
+//PublishMetrics publishes the depth of the job queue, in total and for each priority,
+//under the provided name. Metrics are served by the expvar handler on /debug/vars.
+func PublishMetrics(name string, jobQueue JobQueue) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return queueMetrics{
+			Length:        jobQueue.Len(),
+			LenByPriority: jobQueue.LenByPriority(),
+		}
+	}))
+}
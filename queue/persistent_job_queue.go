@@ -0,0 +1,116 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"k8s.io/klog/v2"
+)
+
+var (
+	//jobsBucket stores all jobs which were enqueued and not yet acknowledged, keyed by job ID
+	jobsBucket = []byte("jobs")
+)
+
+func init() {
+	RegisterBackend("persistent", func(options Options) (JobQueue, error) {
+		return NewPersistentJobQueue(options)
+	})
+}
+
+//PersistentJobQueue is a crash-safe JobQueue which stores jobs in an embedded bbolt
+//database, e.g. on a PersistentVolume. Jobs are only removed from the database once
+//they are acknowledged, so jobs which were enqueued or in flight when the process
+//exited are replayed on startup. Jobs handed back with Nack stay in the database.
+type PersistentJobQueue struct {
+	*MemoryJobQueue
+	db *bolt.DB
+}
+
+//NewPersistentJobQueue opens or creates the database at options.Path and replays
+//all jobs which were not acknowledged, in the order they were enqueued. Replayed jobs
+//are always added, even if there are more than options.Size.
+func NewPersistentJobQueue(options Options) (*PersistentJobQueue, error) {
+	db, err := bolt.Open(options.Path, 0600, &bolt.Options{Timeout: 10 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	pjq := &PersistentJobQueue{
+		MemoryJobQueue: NewMemoryJobQueue(options),
+		db:             db,
+	}
+	var jobs []*Job
+	err = db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(jobsBucket)
+		if err != nil {
+			return err
+		}
+		return bucket.ForEach(func(key, value []byte) error {
+			var job Job
+			if err := json.Unmarshal(value, &job); err != nil {
+				klog.ErrorS(err, "Failed to replay persisted job, discarding", "id", string(key))
+				return nil
+			}
+			jobs = append(jobs, &job)
+			return nil
+		})
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	sort.SliceStable(jobs, func(i, j int) bool { return jobs[i].EnqueuedAt.Before(jobs[j].EnqueuedAt) })
+	for _, job := range jobs {
+		pjq.push(job)
+	}
+	klog.V(1).Infof("Replayed %d persisted jobs from %s", len(jobs), options.Path)
+	return pjq, nil
+}
+
+//Enqueue persists all or none of the jobs in a single transaction and adds them to
+//the end of the queue, waiting for space until the context is done
+func (pjq *PersistentJobQueue) Enqueue(ctx context.Context, jobs ...*Job) error {
+	return pjq.enqueue(ctx, jobs, func(jobs []*Job) error {
+		return pjq.db.Update(func(tx *bolt.Tx) error {
+			bucket := tx.Bucket(jobsBucket)
+			for _, job := range jobs {
+				value, err := json.Marshal(job)
+				if err != nil {
+					return err
+				}
+				if err := bucket.Put([]byte(job.ID), value); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+//Ack removes the job from the database and marks it as handled
+func (pjq *PersistentJobQueue) Ack(job *Job) error {
+	if err := pjq.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(jobsBucket).Delete([]byte(job.ID))
+	}); err != nil {
+		return err
+	}
+	return pjq.MemoryJobQueue.Ack(job)
+}
+
+//Remove removes the job with the ID from the jobs waiting to be dequeued and from the database
+func (pjq *PersistentJobQueue) Remove(id string) error {
+	if err := pjq.MemoryJobQueue.Remove(id); err != nil {
+		return err
+	}
+	return pjq.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(jobsBucket).Delete([]byte(id))
+	})
+}
+
+//Close closes the database
+func (pjq *PersistentJobQueue) Close() error {
+	return pjq.db.Close()
+}
@@ -0,0 +1,294 @@
+package runs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	//runsBucket stores all runs keyed by run ID
+	runsBucket = []byte("runs")
+	//logsBucket stores the container logs of runs keyed by run ID, separately from the
+	//runs so that listing runs does not read the logs
+	logsBucket = []byte("logs")
+	//queuedAtBucket indexes runs by the time they were queued, so that runs are listed
+	//newest first without reading all runs. Keys are the big-endian queued time in
+	//nanoseconds followed by the run ID, values are empty.
+	queuedAtBucket = []byte("runsByQueuedAt")
+)
+
+//BoltStore is a run Store which keeps the run history in an embedded bbolt database,
+//e.g. on a PersistentVolume, so that runs survive restarts
+type BoltStore struct {
+	db *bolt.DB
+}
+
+//NewBoltStore opens or creates the database at the provided path
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 10 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(runsBucket); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(logsBucket); err != nil {
+			return err
+		}
+		return createQueuedAtIndex(tx)
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltStore{db: db}, nil
+}
+
+//queuedAtKey returns the key of the run in the queuedAt index
+func queuedAtKey(queuedAt time.Time, id string) []byte {
+	key := make([]byte, 8, 8+len(id))
+	binary.BigEndian.PutUint64(key, uint64(queuedAt.UnixNano()))
+	return append(key, id...)
+}
+
+//createQueuedAtIndex creates the queuedAt index from the stored runs, unless it
+//exists, e.g. for databases created before runs were indexed
+func createQueuedAtIndex(tx *bolt.Tx) error {
+	if tx.Bucket(queuedAtBucket) != nil {
+		return nil
+	}
+	index, err := tx.CreateBucket(queuedAtBucket)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(runsBucket).ForEach(func(key, value []byte) error {
+		var run Run
+		if err := json.Unmarshal(value, &run); err != nil {
+			return err
+		}
+		return index.Put(queuedAtKey(run.QueuedAt, run.ID), nil)
+	})
+}
+
+//getRun returns the stored run with the ID, or nil if it does not exist
+func getRun(tx *bolt.Tx, id string) (*Run, error) {
+	value := tx.Bucket(runsBucket).Get([]byte(id))
+	if value == nil {
+		return nil, nil
+	}
+	var run Run
+	if err := json.Unmarshal(value, &run); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+//putRun stores the run and indexes it, replacing the index entry of the previously
+//stored version of the run if there is one
+func putRun(tx *bolt.Tx, run, previous *Run) error {
+	value, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	index := tx.Bucket(queuedAtBucket)
+	if previous != nil {
+		if err := index.Delete(queuedAtKey(previous.QueuedAt, previous.ID)); err != nil {
+			return err
+		}
+	}
+	if err := index.Put(queuedAtKey(run.QueuedAt, run.ID), nil); err != nil {
+		return err
+	}
+	return tx.Bucket(runsBucket).Put([]byte(run.ID), value)
+}
+
+//deleteRun removes the run along with its logs and index entry
+func deleteRun(tx *bolt.Tx, run *Run) error {
+	if err := tx.Bucket(queuedAtBucket).Delete(queuedAtKey(run.QueuedAt, run.ID)); err != nil {
+		return err
+	}
+	if err := tx.Bucket(logsBucket).Delete([]byte(run.ID)); err != nil {
+		return err
+	}
+	return tx.Bucket(runsBucket).Delete([]byte(run.ID))
+}
+
+//Create stores a new run
+func (bs *BoltStore) Create(run *Run) error {
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		previous, err := getRun(tx, run.ID)
+		if err != nil {
+			return err
+		}
+		return putRun(tx, run, previous)
+	})
+}
+
+//Get returns the run with the ID
+func (bs *BoltStore) Get(id string) (*Run, error) {
+	var run *Run
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		var err error
+		if run, err = getRun(tx, id); err == nil && run == nil {
+			return ErrRunNotFound
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+//Update applies the update func to the run with the ID in a single transaction
+func (bs *BoltStore) Update(id string, update func(run *Run)) error {
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		previous, err := getRun(tx, id)
+		if err != nil {
+			return err
+		}
+		if previous == nil {
+			return ErrRunNotFound
+		}
+		run := *previous
+		update(&run)
+		return putRun(tx, &run, previous)
+	})
+}
+
+//Delete removes the run with the ID
+func (bs *BoltStore) Delete(id string) error {
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		run, err := getRun(tx, id)
+		if err != nil {
+			return err
+		}
+		if run == nil {
+			return ErrRunNotFound
+		}
+		return deleteRun(tx, run)
+	})
+}
+
+//List returns a page of the runs matching the options, newest first. Runs are read
+//from the queuedAt index, starting after the continue token or before options.Until,
+//until the page is full or runs queued before options.Since are reached.
+func (bs *BoltStore) List(options ListOptions) (ListResult, error) {
+	after, err := options.after()
+	if err != nil {
+		return ListResult{}, err
+	}
+	limit := options.limit()
+	//runs are read from before the exclusive upper bound key
+	var upper []byte
+	if after != nil {
+		upper = queuedAtKey(after.QueuedAt, after.ID)
+	}
+	if !options.Until.IsZero() {
+		if until := queuedAtKey(options.Until, ""); upper == nil || bytes.Compare(until, upper) < 0 {
+			upper = until
+		}
+	}
+	var since []byte
+	if !options.Since.IsZero() {
+		since = queuedAtKey(options.Since, "")
+	}
+	matched := make([]*Run, 0)
+	err = bs.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(queuedAtBucket).Cursor()
+		var key []byte
+		if upper == nil {
+			key, _ = cursor.Last()
+		} else if key, _ = cursor.Seek(upper); key == nil {
+			key, _ = cursor.Last()
+		} else {
+			key, _ = cursor.Prev()
+		}
+		for ; key != nil && len(matched) <= limit; key, _ = cursor.Prev() {
+			if since != nil && bytes.Compare(key, since) < 0 {
+				break
+			}
+			run, err := getRun(tx, string(key[8:]))
+			if err != nil {
+				return err
+			}
+			if run != nil && options.matches(run) {
+				matched = append(matched, run)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return ListResult{}, err
+	}
+	return page(matched, limit), nil
+}
+
+//DeleteFinishedBefore removes all runs which finished before the provided time
+func (bs *BoltStore) DeleteFinishedBefore(before time.Time) (int, error) {
+	deleted := 0
+	err := bs.db.Update(func(tx *bolt.Tx) error {
+		var expired []*Run
+		if err := tx.Bucket(runsBucket).ForEach(func(key, value []byte) error {
+			var run Run
+			if err := json.Unmarshal(value, &run); err != nil {
+				return err
+			}
+			if finishedBefore(&run, before) {
+				expired = append(expired, &run)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		for _, run := range expired {
+			if err := deleteRun(tx, run); err != nil {
+				return err
+			}
+		}
+		deleted = len(expired)
+		return nil
+	})
+	return deleted, err
+}
+
+//SaveLogs stores the container logs of the run with the ID
+func (bs *BoltStore) SaveLogs(id string, logs []ContainerLog) error {
+	value, err := json.Marshal(logs)
+	if err != nil {
+		return err
+	}
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(runsBucket).Get([]byte(id)) == nil {
+			return ErrRunNotFound
+		}
+		return tx.Bucket(logsBucket).Put([]byte(id), value)
+	})
+}
+
+//GetLogs returns the container logs of the run with the ID
+func (bs *BoltStore) GetLogs(id string) ([]ContainerLog, error) {
+	var logs []ContainerLog
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(runsBucket).Get([]byte(id)) == nil {
+			return ErrRunNotFound
+		}
+		if value := tx.Bucket(logsBucket).Get([]byte(id)); value != nil {
+			return json.Unmarshal(value, &logs)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
+
+//Close closes the database
+func (bs *BoltStore) Close() error {
+	return bs.db.Close()
+}
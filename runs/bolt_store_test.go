@@ -0,0 +1,176 @@
+package runs
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var testQueuedAt = time.Date(2021, 11, 1, 12, 0, 0, 0, time.UTC)
+
+//newTestBoltStore returns a store with runs r0 to r5 queued a minute apart, r5 being
+//the newest, r2 and r3 being queued at the same time and r0, r2 and r4 being of runner a
+func newTestBoltStore(t *testing.T, path string) *BoltStore {
+	bs, err := NewBoltStore(path)
+	if err != nil {
+		t.Fatalf("NewBoltStore() error = %v", err)
+	}
+	minutes := []int{0, 1, 2, 2, 4, 5}
+	for i, minute := range minutes {
+		run := &Run{
+			ID:       fmt.Sprintf("r%d", i),
+			Runner:   []string{"a", "b"}[i%2],
+			Phase:    PhaseQueued,
+			QueuedAt: testQueuedAt.Add(time.Duration(minute) * time.Minute),
+		}
+		if err := bs.Create(run); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+	return bs
+}
+
+//listAll lists all pages of runs matching the options and returns the IDs of each page
+func listAll(t *testing.T, bs *BoltStore, options ListOptions) [][]string {
+	var pages [][]string
+	for {
+		result, err := bs.List(options)
+		if err != nil {
+			t.Fatalf("List() error = %v", err)
+		}
+		ids := make([]string, 0)
+		for _, run := range result.Runs {
+			ids = append(ids, run.ID)
+		}
+		pages = append(pages, ids)
+		if result.Continue == "" {
+			return pages
+		}
+		options.Continue = result.Continue
+	}
+}
+
+func TestBoltStoreList(t *testing.T) {
+	tests := []struct {
+		name    string
+		options ListOptions
+		want    [][]string
+	}{
+		{
+			name: "newest first",
+			want: [][]string{{"r5", "r4", "r3", "r2", "r1", "r0"}},
+		},
+		{
+			name:    "pages continue after the last run",
+			options: ListOptions{Limit: 2},
+			want:    [][]string{{"r5", "r4"}, {"r3", "r2"}, {"r1", "r0"}},
+		},
+		{
+			name:    "pages continue between runs queued at the same time",
+			options: ListOptions{Limit: 3},
+			want:    [][]string{{"r5", "r4", "r3"}, {"r2", "r1", "r0"}},
+		},
+		{
+			name:    "last page is not empty",
+			options: ListOptions{Limit: 4},
+			want:    [][]string{{"r5", "r4", "r3", "r2"}, {"r1", "r0"}},
+		},
+		{
+			name:    "since is inclusive",
+			options: ListOptions{Since: testQueuedAt.Add(2 * time.Minute)},
+			want:    [][]string{{"r5", "r4", "r3", "r2"}},
+		},
+		{
+			name:    "until is exclusive",
+			options: ListOptions{Until: testQueuedAt.Add(4 * time.Minute)},
+			want:    [][]string{{"r3", "r2", "r1", "r0"}},
+		},
+		{
+			name:    "since and until with pages",
+			options: ListOptions{Since: testQueuedAt.Add(time.Minute), Until: testQueuedAt.Add(5 * time.Minute), Limit: 2},
+			want:    [][]string{{"r4", "r3"}, {"r2", "r1"}},
+		},
+		{
+			name:    "until after the newest run",
+			options: ListOptions{Until: testQueuedAt.Add(time.Hour)},
+			want:    [][]string{{"r5", "r4", "r3", "r2", "r1", "r0"}},
+		},
+		{
+			name:    "nothing before since",
+			options: ListOptions{Since: testQueuedAt.Add(time.Hour)},
+			want:    [][]string{{}},
+		},
+		{
+			name:    "filters with pages",
+			options: ListOptions{Runner: "a", Limit: 2},
+			want:    [][]string{{"r4", "r2"}, {"r0"}},
+		},
+	}
+	bs := newTestBoltStore(t, filepath.Join(t.TempDir(), "runs.db"))
+	defer bs.Close()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := listAll(t, bs, tt.options); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("List() pages = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBoltStoreListInvalidContinue(t *testing.T) {
+	bs := newTestBoltStore(t, filepath.Join(t.TempDir(), "runs.db"))
+	defer bs.Close()
+	for _, token := range []string{"%", "bm90LWEtdG9rZW4", "YS9yMQ"} {
+		if _, err := bs.List(ListOptions{Continue: token}); !errors.Is(err, ErrInvalidContinue) {
+			t.Errorf("List() with continue %q error = %v, want %v", token, err, ErrInvalidContinue)
+		}
+	}
+}
+
+func TestBoltStoreListAfterUpdateAndDelete(t *testing.T) {
+	bs := newTestBoltStore(t, filepath.Join(t.TempDir(), "runs.db"))
+	defer bs.Close()
+	if err := bs.Update("r0", func(run *Run) {
+		run.QueuedAt = testQueuedAt.Add(time.Hour)
+	}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if err := bs.Delete("r4"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	want := [][]string{{"r0", "r5", "r3", "r2", "r1"}}
+	if got := listAll(t, bs, ListOptions{}); !reflect.DeepEqual(got, want) {
+		t.Errorf("List() pages = %v, want %v", got, want)
+	}
+}
+
+func TestBoltStoreCreatesMissingIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "runs.db")
+	if err := newTestBoltStore(t, path).Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatalf("bolt.Open() error = %v", err)
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket(queuedAtBucket)
+	}); err != nil {
+		t.Fatalf("DeleteBucket() error = %v", err)
+	}
+	db.Close()
+	bs, err := NewBoltStore(path)
+	if err != nil {
+		t.Fatalf("NewBoltStore() error = %v", err)
+	}
+	defer bs.Close()
+	want := [][]string{{"r5", "r4", "r3"}, {"r2", "r1", "r0"}}
+	if got := listAll(t, bs, ListOptions{Limit: 3}); !reflect.DeepEqual(got, want) {
+		t.Errorf("List() pages = %v, want %v", got, want)
+	}
+}
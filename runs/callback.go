@@ -0,0 +1,183 @@
+package runs
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	//SignatureHeader holds the hex encoded HMAC-SHA256 of the callback body, prefixed with sha256=
+	SignatureHeader = "X-Events-Runner-Signature"
+	//callbackBackoff is the delay before the first retry of a failed callback, doubled for every retry
+	callbackBackoff = time.Second
+)
+
+//CallbackPayload is the body of a callback request
+type CallbackPayload struct {
+	RunID      string     `json:"runId"`
+	Status     Phase      `json:"status"`
+	JobName    string     `json:"jobName,omitempty"`
+	Runner     string     `json:"runner"`
+	Resource   string     `json:"resource"`
+	EventType  string     `json:"eventType"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	//Duration is the number of seconds from the start of the Job until it finished
+	Duration float64 `json:"duration"`
+	Reason   string  `json:"reason,omitempty"`
+	Message  string  `json:"message,omitempty"`
+	ExitCode *int32  `json:"exitCode,omitempty"`
+}
+
+//newCallbackPayload describes the outcome of the finished run
+func newCallbackPayload(run *Run) CallbackPayload {
+	payload := CallbackPayload{
+		RunID:      run.ID,
+		Status:     run.Phase,
+		JobName:    run.JobName,
+		Runner:     run.Runner,
+		Resource:   run.Resource,
+		EventType:  run.EventType,
+		StartedAt:  run.StartedAt,
+		FinishedAt: run.FinishedAt,
+		Reason:     run.Reason,
+		Message:    run.Message,
+		ExitCode:   run.ExitCode,
+	}
+	if run.StartedAt != nil && run.FinishedAt != nil {
+		payload.Duration = run.FinishedAt.Sub(*run.StartedAt).Seconds()
+	}
+	return payload
+}
+
+//CallbackStore wraps a run Store and calls the callback of every run which is updated
+//into a finished phase. Callbacks are retried with exponential backoff and their
+//delivery is recorded with the run. Callback bodies are signed with HMAC-SHA256 using
+//the secret, see SignatureHeader, unless the secret is empty.
+type CallbackStore struct {
+	Store
+	secret []byte
+	client *http.Client
+}
+
+//NewCallbackStore wraps the run store, signing callbacks with the secret
+func NewCallbackStore(store Store, secret []byte) *CallbackStore {
+	return &CallbackStore{
+		Store:  store,
+		secret: secret,
+		client: &http.Client{},
+	}
+}
+
+//Update applies the update func to the run with the ID and calls the callback of the
+//run in the background if the run finished with this update
+func (cs *CallbackStore) Update(id string, update func(run *Run)) error {
+	var finished *Run
+	err := cs.Store.Update(id, func(run *Run) {
+		wasFinished := run.Phase.Finished()
+		update(run)
+		if !wasFinished && run.Phase.Finished() && run.Callback != nil {
+			copied, callback := *run, *run.Callback
+			copied.Callback = &callback
+			finished = &copied
+		}
+	})
+	if err == nil && finished != nil {
+		go cs.deliver(finished)
+	}
+	return err
+}
+
+//sign returns the signature header value of the body
+func (cs *CallbackStore) sign(body []byte) string {
+	mac := hmac.New(sha256.New, cs.secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+//post sends a single callback request, returning whether a failed request can be retried
+func (cs *CallbackStore) post(callback *Callback, runID string, body []byte) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(callback.Timeout))
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, callback.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Events-Runner-Run-ID", runID)
+	if len(cs.secret) > 0 {
+		req.Header.Set(SignatureHeader, cs.sign(body))
+	}
+	resp, err := cs.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retryable := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusRequestTimeout
+	return retryable, fmt.Errorf("callback returned status %d", resp.StatusCode)
+}
+
+//deliver calls the callback of the finished run, retrying failed requests with
+//exponential backoff, and records the delivery with the run
+func (cs *CallbackStore) deliver(run *Run) {
+	callback := run.Callback
+	body, err := json.Marshal(newCallbackPayload(run))
+	if err != nil {
+		klog.Errorf("Failed to encode callback of run %s: %v", run.ID, err)
+		return
+	}
+	backoff := callbackBackoff
+	attempts := 0
+	for {
+		attempts++
+		retryable, err := cs.post(callback, run.ID, body)
+		if err == nil {
+			klog.V(1).Infof("Delivered callback of run %s to %s", run.ID, callback.URL)
+			cs.recordDelivery(run.ID, attempts, nil)
+			return
+		}
+		if !retryable || attempts > callback.Retries {
+			klog.Errorf("Failed to deliver callback of run %s to %s after %d attempts: %v", run.ID, callback.URL, attempts, err)
+			cs.recordDelivery(run.ID, attempts, err)
+			return
+		}
+		klog.V(1).Infof("Failed to deliver callback of run %s, retrying in %s: %v", run.ID, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+//recordDelivery records the outcome of the callback delivery with the run
+func (cs *CallbackStore) recordDelivery(id string, attempts int, deliveryErr error) {
+	if err := cs.Store.Update(id, func(run *Run) {
+		if run.Callback == nil {
+			return
+		}
+		//the callback is replaced rather than changed, as copies of the run may share it
+		callback := *run.Callback
+		callback.Attempts = attempts
+		callback.Delivered = deliveryErr == nil
+		callback.LastError = ""
+		if deliveryErr != nil {
+			callback.LastError = deliveryErr.Error()
+		}
+		run.Callback = &callback
+	}); err != nil {
+		klog.V(2).Infof("Failed to record callback delivery of run %s: %v", id, err)
+	}
+}
@@ -0,0 +1,135 @@
+package runs
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	//DefaultListLimit is the number of runs returned by List if no limit is set
+	DefaultListLimit = 50
+	//MaxListLimit is the maximum number of runs returned by List
+	MaxListLimit = 500
+)
+
+var (
+	//ErrInvalidContinue is returned by List when the continue token cannot be parsed
+	ErrInvalidContinue = errors.New("invalid continue token")
+)
+
+//ListOptions filters and paginates the runs returned by List. Empty filters match all
+//runs. Since and Until limit the time the runs were queued at.
+type ListOptions struct {
+	Runner    string
+	Resource  string
+	EventType string
+	Phase     Phase
+	Since     time.Time
+	Until     time.Time
+	//Limit is the maximum number of runs returned, DefaultListLimit if 0
+	Limit int
+	//Continue is the token returned by the previous List call to get the next page
+	Continue string
+}
+
+//ListResult is a page of runs. Continue is set if more runs match the options.
+type ListResult struct {
+	Runs     []*Run `json:"runs"`
+	Continue string `json:"continue,omitempty"`
+}
+
+//matches reports whether the run matches the filters of the options
+func (lo ListOptions) matches(run *Run) bool {
+	return (lo.Runner == "" || run.Runner == lo.Runner) &&
+		(lo.Resource == "" || run.Resource == lo.Resource) &&
+		(lo.EventType == "" || run.EventType == lo.EventType) &&
+		(lo.Phase == "" || run.Phase == lo.Phase) &&
+		(lo.Since.IsZero() || !run.QueuedAt.Before(lo.Since)) &&
+		(lo.Until.IsZero() || run.QueuedAt.Before(lo.Until))
+}
+
+//newerThan orders runs newest first, by the time they were queued and then by ID
+func newerThan(a, b *Run) bool {
+	if !a.QueuedAt.Equal(b.QueuedAt) {
+		return a.QueuedAt.After(b.QueuedAt)
+	}
+	return a.ID > b.ID
+}
+
+//continueToken encodes the position of the run, so that the next page starts after it
+func continueToken(run *Run) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d/%s", run.QueuedAt.UnixNano(), run.ID)))
+}
+
+//parseContinueToken decodes the position of the last run of the previous page
+func parseContinueToken(token string) (*Run, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidContinue
+	}
+	parts := strings.SplitN(string(data), "/", 2)
+	if len(parts) != 2 {
+		return nil, ErrInvalidContinue
+	}
+	queuedAt, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidContinue
+	}
+	return &Run{ID: parts[1], QueuedAt: time.Unix(0, queuedAt)}, nil
+}
+
+//limit returns the maximum number of runs returned for the options
+func (lo ListOptions) limit() int {
+	if lo.Limit <= 0 {
+		return DefaultListLimit
+	}
+	if lo.Limit > MaxListLimit {
+		return MaxListLimit
+	}
+	return lo.Limit
+}
+
+//after returns the position of the last run of the previous page, or nil for the first page
+func (lo ListOptions) after() (*Run, error) {
+	if lo.Continue == "" {
+		return nil, nil
+	}
+	return parseContinueToken(lo.Continue)
+}
+
+//page returns the first limit runs of the matched runs, which are ordered newest
+//first, and the continue token if more runs matched
+func page(matched []*Run, limit int) ListResult {
+	result := ListResult{Runs: matched}
+	if len(matched) > limit {
+		result.Runs = matched[:limit]
+		result.Continue = continueToken(matched[limit-1])
+	}
+	return result
+}
+
+//paginate filters, sorts and paginates the runs according to the options
+func paginate(runs []*Run, options ListOptions) (ListResult, error) {
+	after, err := options.after()
+	if err != nil {
+		return ListResult{}, err
+	}
+	matched := make([]*Run, 0)
+	for _, run := range runs {
+		if options.matches(run) && (after == nil || newerThan(after, run)) {
+			matched = append(matched, run)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return newerThan(matched[i], matched[j]) })
+	return page(matched, options.limit()), nil
+}
+
+//finishedBefore reports whether the run finished before the provided time
+func finishedBefore(run *Run, before time.Time) bool {
+	return run.Phase.Finished() && run.FinishedAt != nil && run.FinishedAt.Before(before)
+}
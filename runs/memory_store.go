@@ -0,0 +1,137 @@
+package runs
+
+import (
+	"sync"
+	"time"
+)
+
+//MemoryStore is an in memory run Store. Runs are lost when the process exits.
+type MemoryStore struct {
+	mutex sync.RWMutex
+	runs  map[string]*Run
+	logs  map[string][]ContainerLog
+}
+
+//NewMemoryStore instanciates a MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		runs: make(map[string]*Run),
+		logs: make(map[string][]ContainerLog),
+	}
+}
+
+//copyRun returns a copy of the run which shares no pointers with it, so that stored
+//runs are not changed by callers and callers do not see later updates. The event is
+//shared, as it is never changed once the run is created.
+func copyRun(run *Run) *Run {
+	copied := *run
+	copyTime := func(t *time.Time) *time.Time {
+		if t == nil {
+			return nil
+		}
+		copiedTime := *t
+		return &copiedTime
+	}
+	copied.DispatchedAt = copyTime(run.DispatchedAt)
+	copied.StartedAt = copyTime(run.StartedAt)
+	copied.FinishedAt = copyTime(run.FinishedAt)
+	if run.ExitCode != nil {
+		exitCode := *run.ExitCode
+		copied.ExitCode = &exitCode
+	}
+	if run.Callback != nil {
+		callback := *run.Callback
+		copied.Callback = &callback
+	}
+	return &copied
+}
+
+//Create stores a new run
+func (ms *MemoryStore) Create(run *Run) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	ms.runs[run.ID] = copyRun(run)
+	return nil
+}
+
+//Get returns a copy of the run with the ID
+func (ms *MemoryStore) Get(id string) (*Run, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+	run, ok := ms.runs[id]
+	if !ok {
+		return nil, ErrRunNotFound
+	}
+	return copyRun(run), nil
+}
+
+//Update applies the update func to the run with the ID
+func (ms *MemoryStore) Update(id string, update func(run *Run)) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	run, ok := ms.runs[id]
+	if !ok {
+		return ErrRunNotFound
+	}
+	update(run)
+	return nil
+}
+
+//Delete removes the run with the ID
+func (ms *MemoryStore) Delete(id string) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if _, ok := ms.runs[id]; !ok {
+		return ErrRunNotFound
+	}
+	delete(ms.runs, id)
+	delete(ms.logs, id)
+	return nil
+}
+
+//List returns a page of the runs matching the options, newest first
+func (ms *MemoryStore) List(options ListOptions) (ListResult, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+	runs := make([]*Run, 0, len(ms.runs))
+	for _, run := range ms.runs {
+		runs = append(runs, copyRun(run))
+	}
+	return paginate(runs, options)
+}
+
+//DeleteFinishedBefore removes all runs which finished before the provided time
+func (ms *MemoryStore) DeleteFinishedBefore(before time.Time) (int, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	deleted := 0
+	for id, run := range ms.runs {
+		if finishedBefore(run, before) {
+			delete(ms.runs, id)
+			delete(ms.logs, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+//SaveLogs stores the container logs of the run with the ID
+func (ms *MemoryStore) SaveLogs(id string, logs []ContainerLog) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if _, ok := ms.runs[id]; !ok {
+		return ErrRunNotFound
+	}
+	ms.logs[id] = logs
+	return nil
+}
+
+//GetLogs returns the container logs of the run with the ID
+func (ms *MemoryStore) GetLogs(id string) ([]ContainerLog, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+	if _, ok := ms.runs[id]; !ok {
+		return nil, ErrRunNotFound
+	}
+	return ms.logs[id], nil
+}
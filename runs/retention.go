@@ -0,0 +1,34 @@
+package runs
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+//RunRetention removes runs which finished more than retention ago from the store every
+//interval, until the context is done. Runs are kept forever if retention is 0.
+func RunRetention(ctx context.Context, store Store, retention, interval time.Duration) {
+	if retention <= 0 {
+		return
+	}
+	if interval <= 0 {
+		interval = retention
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		deleted, err := store.DeleteFinishedBefore(time.Now().Add(-retention))
+		if err != nil {
+			klog.Errorf("Failed to remove expired runs: %v", err)
+		} else if deleted > 0 {
+			klog.V(1).Infof("Removed %d runs which finished more than %s ago", deleted, retention)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
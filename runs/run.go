@@ -0,0 +1,172 @@
+package runs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/luqmanMohammed/k8s-events-runner/config"
+	queue "github.com/luqmanMohammed/k8s-events-runner/queue"
+)
+
+var (
+	//ErrRunNotFound is returned when a run with the requested ID does not exist
+	ErrRunNotFound = errors.New("run not found")
+	//ErrRunFinished is returned when a run which already finished is cancelled
+	ErrRunFinished = errors.New("run already finished")
+)
+
+//Phase is the state of a run
+type Phase string
+
+//Run phases. A run is Queued until the kubernetes Job is created, Pending until the
+//Job has active pods and Running until the Job completes or fails, unless it is Cancelled.
+const (
+	PhaseQueued       Phase = "Queued"
+	PhasePending      Phase = "Pending"
+	PhaseRunning      Phase = "Running"
+	PhaseSucceeded    Phase = "Succeeded"
+	PhaseFailed       Phase = "Failed"
+	PhaseDeadLettered Phase = "DeadLettered"
+	PhaseCancelled    Phase = "Cancelled"
+)
+
+//Finished reports whether the run reached a final phase
+func (p Phase) Finished() bool {
+	return p == PhaseSucceeded || p == PhaseFailed || p == PhaseDeadLettered || p == PhaseCancelled
+}
+
+//Run records the outcome of a job. The run ID is the ID of the job. TemplateHash
+//identifies the rendered runner template the Job was created from.
+type Run struct {
+	ID           string       `json:"id"`
+	Runner       string       `json:"runner"`
+	Resource     string       `json:"resource"`
+	EventType    string       `json:"eventType"`
+	Event        config.Event `json:"event"`
+	TemplateHash string       `json:"templateHash,omitempty"`
+	Phase        Phase        `json:"phase"`
+	JobName      string       `json:"jobName,omitempty"`
+	QueuedAt     time.Time    `json:"queuedAt"`
+	DispatchedAt *time.Time   `json:"dispatchedAt,omitempty"`
+	StartedAt    *time.Time   `json:"startedAt,omitempty"`
+	FinishedAt   *time.Time   `json:"finishedAt,omitempty"`
+	//Reason and Message describe why the run reached its phase, e.g. BackoffLimitExceeded
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+	//ExitCode and ExitReason describe how the failed container of a failed run terminated
+	ExitCode   *int32 `json:"exitCode,omitempty"`
+	ExitReason string `json:"exitReason,omitempty"`
+	//DispatchAttempts is the number of failed attempts to create the Job and Retries
+	//the number of pods of the Job which failed and were retried
+	DispatchAttempts int   `json:"dispatchAttempts,omitempty"`
+	Retries          int32 `json:"retries,omitempty"`
+	//LogsCaptured is set once the container logs of the run were stored, see Store.GetLogs
+	LogsCaptured bool `json:"logsCaptured,omitempty"`
+	//Callback is called with the outcome of the run once it finished
+	Callback *Callback `json:"callback,omitempty"`
+}
+
+//Callback records the callback of a run and its delivery
+type Callback struct {
+	URL       string          `json:"url"`
+	Timeout   config.Duration `json:"timeout"`
+	Retries   int             `json:"retries"`
+	Delivered bool            `json:"delivered"`
+	Attempts  int             `json:"attempts,omitempty"`
+	LastError string          `json:"lastError,omitempty"`
+}
+
+//Cancel records the run as cancelled, unless it already finished
+func (r *Run) Cancel(message string) {
+	if r.Phase.Finished() {
+		return
+	}
+	now := time.Now()
+	r.Phase = PhaseCancelled
+	r.FinishedAt = &now
+	r.Reason = "Cancelled"
+	r.Message = message
+}
+
+//newCallback returns the callback of the job, using the callback URL of the event or of
+//the runner selector, or nil if neither sets one
+func newCallback(job *queue.Job) *Callback {
+	callbackURL := job.CallbackURL
+	if callbackURL == "" && job.Callback != nil {
+		callbackURL = job.Callback.URL
+	}
+	if callbackURL == "" {
+		return nil
+	}
+	return &Callback{
+		URL:     callbackURL,
+		Timeout: config.Duration(job.Callback.CallbackTimeout()),
+		Retries: job.Callback.CallbackRetries(),
+	}
+}
+
+//ContainerLog is the captured log of a container of a runner pod. Logs are capped in
+//size, Truncated is set if the beginning of the log was dropped.
+type ContainerLog struct {
+	Pod       string `json:"pod"`
+	Container string `json:"container"`
+	Log       string `json:"log"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+//templateHash returns the sha256 hash of the json representation of the runner template
+func templateHash(runnerTemplate *config.RunnerTemplate) string {
+	if runnerTemplate == nil {
+		return ""
+	}
+	data, err := json.Marshal(runnerTemplate)
+	if err != nil {
+		return ""
+	}
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+//NewRun creates a queued run for the job
+func NewRun(job *queue.Job) *Run {
+	queuedAt := job.EnqueuedAt
+	if queuedAt.IsZero() {
+		queuedAt = time.Now()
+	}
+	return &Run{
+		ID:           job.ID,
+		Runner:       job.Runner,
+		Resource:     job.Resource,
+		EventType:    job.EventType,
+		Event:        job.Event,
+		TemplateHash: templateHash(job.RunnerTemplate),
+		Phase:        PhaseQueued,
+		QueuedAt:     queuedAt,
+		Callback:     newCallback(job),
+	}
+}
+
+//Store is implemented by all run stores
+type Store interface {
+	//Create stores a new run
+	Create(run *Run) error
+	//Get returns a copy of the run with the ID or ErrRunNotFound
+	Get(id string) (*Run, error)
+	//Update applies the update func to the run with the ID or returns ErrRunNotFound
+	Update(id string, update func(run *Run)) error
+	//Delete removes the run with the ID or returns ErrRunNotFound
+	Delete(id string) error
+	//List returns a page of the runs matching the options, newest first
+	List(options ListOptions) (ListResult, error)
+	//DeleteFinishedBefore removes all runs which finished before the provided time and
+	//returns the number of removed runs
+	DeleteFinishedBefore(before time.Time) (int, error)
+	//SaveLogs stores the container logs of the run with the ID or returns ErrRunNotFound.
+	//Logs are removed along with the run.
+	SaveLogs(id string, logs []ContainerLog) error
+	//GetLogs returns the container logs of the run with the ID or ErrRunNotFound
+	GetLogs(id string) ([]ContainerLog, error)
+}
@@ -1,8 +1,47 @@
 package utils
 
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
 func MergeStringStringMaps(A, B map[string]string) map[string]string {
 	for k, v := range B {
 		A[k] = v
 	}
 	return A
 }
+
+var (
+	invalidLabelValueChars = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+	invalidNameChars       = regexp.MustCompile(`[^a-z0-9-]`)
+)
+
+//SanitizeLabelValue converts the string into a valid label value, e.g. apps/v1/deployments
+//becomes apps.v1.deployments
+func SanitizeLabelValue(value string) string {
+	value = invalidLabelValueChars.ReplaceAllString(value, ".")
+	if len(value) > validation.LabelValueMaxLength {
+		value = value[:validation.LabelValueMaxLength]
+	}
+	return strings.Trim(value, "_.-")
+}
+
+//SanitizeName converts the string into a valid prefix for generated object names,
+//e.g. apps/v1/deployments becomes apps-v1-deployments
+func SanitizeName(name string) string {
+	return invalidNameChars.ReplaceAllString(strings.ToLower(name), "-")
+}
+
+//NewID generates a random hex encoded ID
+func NewID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(id)
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -33,3 +34,12 @@ func GetKubeClientSet(isLocal bool, kubeConfigPath string) (*kubernetes.Clientse
 	}
 	return kubernetes.NewForConfig(config)
 }
+
+//GetKubeDynamicClient creates and returns a dynamic client getting config dynamically
+func GetKubeDynamicClient(isLocal bool, kubeConfigPath string) (dynamic.Interface, error) {
+	config, err := getKubeAPIConfig(isLocal, kubeConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	return dynamic.NewForConfig(config)
+}